@@ -3,32 +3,94 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 	"unicorn/factory"
 	unicornhttp "unicorn/http"
 	"unicorn/internal/app"
+	"unicorn/pkg/syncrand"
+	"unicorn/registry"
 	"unicorn/storage"
+	"unicorn/storage/disk"
+	"unicorn/storage/fifo"
 	"unicorn/storage/lifo"
+	"unicorn/storage/ranked"
 )
 
 // Defaults.
 const (
-	defaultAddr           = ":8000"
-	defaultProductionRate = time.Duration(5) * time.Second
+	defaultAddr            = ":8000"
+	defaultProductionRate  = time.Duration(5) * time.Second
+	defaultBuildRate       = 10 * time.Second
+	defaultLines           = 1
+	defaultStorage         = "memory"
+	defaultStoragePath     = "unicorns.log"
+	defaultStorageOverflow = "drop-newest"
+	defaultOrdersInterval  = 10 * time.Second
+	defaultWebhookRetries  = 5
+	defaultWebhookBackoff  = time.Second
+	defaultOrderTTL        = time.Hour
+	defaultReapInterval    = time.Minute
+	defaultPriorityAging   = 5 * time.Minute
+	defaultAllocation      = "fifo"
+	defaultAllocationN     = 4
+	defaultCapabilityCount = "3"
+	defaultOrderIDs        = "random"
+
+	defaultAutoscaleInterval = 5 * time.Second
+	defaultAutoscaleMinRate  = time.Second
+	defaultAutoscaleMaxRate  = 10 * time.Second
+	defaultAutoscaleHorizon  = time.Minute
+	defaultAutoscaleStock    = 10
 
 	defaultReadHeaderTimeout = 2 * time.Second
 )
 
 func main() {
 	var (
-		addr           = flag.String("addr", defaultAddr, "http server address")
-		productionRate = flag.Duration("rate", defaultProductionRate, "period in which the production line will generate a new unicorn")
+		addr              = flag.String("addr", defaultAddr, "http server address")
+		productionRate    = flag.Duration("rate", defaultProductionRate, "period in which the production line will generate a new unicorn")
+		lines             = flag.Int("lines", defaultLines, "number of production lines")
+		buildRate         = flag.Duration("build-rate", defaultBuildRate, "period in which the build line builds a custom unicorn")
+		lineRates         = flag.String("line-rates", "", "comma separated production rates of each line, such as 5s,3s. lines without rate use -rate")
+		autoscale         = flag.Bool("autoscale", false, "adjust the production rate to the pending orders and the unicorns in stock")
+		autoscaleInterval = flag.Duration("autoscale-interval", defaultAutoscaleInterval, "period in which the production rate is adjusted")
+		autoscaleMinRate  = flag.Duration("autoscale-min-rate", defaultAutoscaleMinRate, "fastest production rate of a line when autoscaling")
+		autoscaleMaxRate  = flag.Duration("autoscale-max-rate", defaultAutoscaleMaxRate, "slowest production rate of a line when autoscaling")
+		autoscaleHorizon  = flag.Duration("autoscale-horizon", defaultAutoscaleHorizon, "time in which the pending orders should be produced when autoscaling")
+		autoscaleStock    = flag.Int("autoscale-stock", defaultAutoscaleStock, "unicorns in stock above which the production pauses when autoscaling")
+		storageKind       = flag.String("storage", defaultStorage, "unicorn storage to use: memory (lifo), fifo, ranked or disk")
+		storagePath       = flag.String("storage-path", defaultStoragePath, "path of the unicorn storage log when using disk storage")
+		storageCapacity   = flag.Int("storage-capacity", 0, "maximum number of unicorns in storage. unlimited if zero")
+		storageOverflow   = flag.String("storage-overflow", defaultStorageOverflow, "policy when the storage is full: drop-newest, evict-oldest or backpressure")
+		registryPath      = flag.String("registry-path", "", "path of the unicorn registry log. the registry is not persisted if empty")
+		ordersPath        = flag.String("orders-path", "", "path of the pending orders snapshot file. orders are not persisted if empty")
+		ordersInterval    = flag.Duration("orders-interval", defaultOrdersInterval, "period in which the pending orders are persisted")
+		webhookSecret     = flag.String("webhook-secret", "", "secret used to sign the order callbacks. callbacks are not signed if empty")
+		webhookRetries    = flag.Int("webhook-retries", defaultWebhookRetries, "number of retries of a failed order callback")
+		webhookBackoff    = flag.Duration("webhook-backoff", defaultWebhookBackoff, "initial wait before retrying a failed order callback, doubled on each retry")
+		orderTTL          = flag.Duration("order-ttl", defaultOrderTTL, "time orders are kept without being polled, before expiring. orders never expire if zero")
+		reapInterval      = flag.Duration("reap-interval", defaultReapInterval, "period in which expired orders are removed")
+		allocation        = flag.String("allocation", defaultAllocation, "strategy to allocate the production among orders: fifo, round-robin or proportional")
+		allocationN       = flag.Int("allocation-width", defaultAllocationN, "number of orders fulfilled at the same time by the round-robin and proportional allocations")
+		priorityAging     = flag.Duration("priority-aging", defaultPriorityAging, "waiting time for a queued order to be promoted one priority. no aging if zero")
+		fixturesDir       = flag.String("fixtures", "", "directory with petnames.txt, adj.txt, capabilities.txt and rules.txt overriding the embedded ones")
+		capabilitiesPath  = flag.String("capabilities", "", "path of the line separated capability catalog. overrides the fixtures one")
+		capabilityCount   = flag.String("capability-count", defaultCapabilityCount, "capabilities of each unicorn: a number such as 3, a range such as 1-5, or weighted numbers such as 1:5,2:3,3:1")
+		rulesPath         = flag.String("rules", "", "path of the line separated capability rules. overrides the fixtures ones")
+		seed              = flag.Int64("seed", 0, "seed of the unicorns and order IDs, to reproduce a run. random if zero, and order IDs are unguessable")
+		orderIDs          = flag.String("order-ids", defaultOrderIDs, "format of the order IDs: random, ulid or uuid")
+		uniqueNames       = flag.Bool("unique-names", false, "guarantee that no two unicorns share a name, suffixing the repeated names")
+		adminToken        = flag.String("admin-token", "", "bearer token required by the admin API. the admin API is disabled if empty")
 	)
 
 	flag.Parse()
@@ -36,24 +98,130 @@ func main() {
 	logger := log.New(os.Stdout, "unicorn: ", log.Lshortfile)
 
 	logger.Println("setting up service ...")
-	logger.Printf("config: prod-rate=%v", productionRate)
+
+	// order IDs are only seeded on demand, since they could be guessed from the seed
+	var idEntropy io.Reader
+	if *seed != 0 {
+		idEntropy = syncrand.NewSeeded(*seed)
+		logger.Printf("warning: order IDs are seeded and can be guessed")
+	}
+
+	// log the random seed as well, so that the unicorns of any run can be reproduced
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	idGenerator, err := parseOrderIDs(*orderIDs, idEntropy)
+	if err != nil {
+		logger.Fatalf("configuring order IDs: %v", err)
+	}
+
+	logger.Printf("config: prod-rate=%v lines=%d storage=%s allocation=%s seed=%d", *productionRate, *lines, *storageKind, *allocation, *seed)
 
 	// Setup dependencies
-	factory, err := factory.New(factory.NCapabilities(3))
+	counts, err := factory.ParseCapabilityCounts(*capabilityCount)
+	if err != nil {
+		logger.Fatalf("parsing capability count: %v", err)
+	}
+
+	factoryOptions := []factory.Option{factory.CapabilityCounts(counts), factory.Seed(*seed)}
+	if *fixturesDir != "" {
+		factoryOptions = append(factoryOptions, factory.FixturesDir(*fixturesDir))
+	}
+	if *capabilitiesPath != "" {
+		factoryOptions = append(factoryOptions, factory.CapabilitiesFile(*capabilitiesPath))
+	}
+	if *rulesPath != "" {
+		factoryOptions = append(factoryOptions, factory.RulesFile(*rulesPath))
+	}
+	if *uniqueNames {
+		factoryOptions = append(factoryOptions, factory.UniqueNames())
+	}
+
+	factory, err := factory.New(factoryOptions...)
 	if err != nil {
 		logger.Fatalf("creating unicorn factory: %v", err)
 	}
 
-	var storage storage.UnicornStorage = storage.WithLogs(logger, lifo.New())
+	overflow, err := storage.ParseOverflowPolicy(*storageOverflow)
+	if err != nil {
+		logger.Fatalf("configuring unicorn storage: %v", err)
+	}
+
+	store, closeStore, err := openStorage(*storageKind, *storagePath, storage.WithCapacity(*storageCapacity, overflow))
+	if err != nil {
+		logger.Fatalf("opening unicorn storage: %v", err)
+	}
+	defer func() {
+		if err := closeStore(); err != nil {
+			logger.Printf("could not properly close the unicorn storage: %v", err)
+		}
+	}()
 
-	logictics := app.NewLogisticsCenter(storage)
+	var storage storage.UnicornStorage = storage.WithLogs(logger, store)
 
-	productionLine := app.NewProductionLine(factory, logictics)
+	reg := registry.New()
+	if *registryPath != "" {
+		if reg, err = registry.Open(*registryPath); err != nil {
+			logger.Fatalf("opening unicorn registry: %v", err)
+		}
+	}
+	defer func() {
+		if err := reg.Close(); err != nil {
+			logger.Printf("could not properly close the unicorn registry: %v", err)
+		}
+	}()
+
+	alloc, err := parseAllocation(*allocation, *allocationN)
 	if err != nil {
-		logger.Fatalf("creating unicorn production line: %v", err)
+		logger.Fatalf("configuring logistics: %v", err)
 	}
 
-	service := app.New(logictics)
+	logictics := app.NewLogisticsCenter(
+		storage,
+		app.WithAllocation(alloc),
+		app.WithAging(*priorityAging),
+		app.WithRecorder(reg),
+	)
+
+	rates, err := parseRates(*lineRates, *lines, *productionRate)
+	if err != nil {
+		logger.Fatalf("configuring production lines: %v", err)
+	}
+
+	plant := app.NewPlant(logictics, factory)
+	for _, rate := range rates {
+		if _, err := plant.NewLine(rate); err != nil {
+			logger.Fatalf("creating unicorn production line: %v", err)
+		}
+	}
+
+	builds, err := app.NewBuildLine(factory, logictics, *buildRate)
+	if err != nil {
+		logger.Fatalf("creating unicorn build line: %v", err)
+	}
+
+	webhooks := app.NewWebhooks(*webhookSecret, *webhookRetries, *webhookBackoff)
+
+	service := app.New(
+		logictics,
+		app.WithBuildLine(builds),
+		app.WithCatalog(factory),
+		app.WithWebhooks(webhooks),
+		app.WithOrderTTL(*orderTTL),
+		app.WithOrderIDs(idGenerator),
+	)
+
+	var orders app.OrderRepository
+	if *ordersPath != "" {
+		orders = app.NewFileRepository(*ordersPath)
+
+		n, err := service.RestoreOrders(orders)
+		if err != nil {
+			logger.Fatalf("restoring pending orders: %v", err)
+		}
+		logger.Printf("restored %d pending orders from %s", n, *ordersPath)
+	}
 
 	// Setup context cancellation for graceful shutdown
 	ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
@@ -69,10 +237,42 @@ func main() {
 			unicornhttp.HandleGetUnicorns(service),
 		))
 
+		mux.Handle("/unicorns/", unicornhttp.WithLogs(
+			logger,
+			http.StripPrefix("/unicorns/", unicornhttp.HandleRegistry(reg)),
+		))
+
+		mux.Handle("/unicorns/events", unicornhttp.WithLogs(
+			logger,
+			unicornhttp.HandleUnicornEvents(service),
+		))
+
+		mux.Handle("/orders", unicornhttp.WithLogs(
+			logger,
+			unicornhttp.HandleOrders(service),
+		))
+
+		mux.Handle("/orders/", unicornhttp.WithLogs(
+			logger,
+			http.StripPrefix("/orders/", unicornhttp.HandleOrder(service)),
+		))
+
+		if *adminToken != "" {
+			mux.Handle("/admin/production/", unicornhttp.WithLogs(
+				logger,
+				unicornhttp.WithToken(*adminToken, http.StripPrefix(
+					"/admin/production",
+					unicornhttp.HandleProduction(plant),
+				)),
+			))
+		}
+
 		httpSrv := http.Server{
 			Addr:              *addr,
 			Handler:           mux,
 			ReadHeaderTimeout: defaultReadHeaderTimeout,
+			// cancel the requests context on shutdown, so that streamed responses end.
+			BaseContext: func(net.Listener) context.Context { return ctx },
 		}
 
 		wg.Add(1)
@@ -99,11 +299,168 @@ func main() {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		productionLine.StartProduction(ctx, *productionRate)
+		plant.StartProduction(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		builds.StartProduction(ctx)
 	}()
 
+	// Adjust production
+	if *autoscale {
+		autoscaler, err := app.NewAutoscaler(plant, logictics, app.AutoscalerConfig{
+			MinRate:     *autoscaleMinRate,
+			MaxRate:     *autoscaleMaxRate,
+			Horizon:     *autoscaleHorizon,
+			TargetStock: *autoscaleStock,
+		})
+		if err != nil {
+			logger.Fatalf("configuring autoscaling: %v", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			autoscaler.StartAutoscaling(ctx, *autoscaleInterval)
+		}()
+	}
+
+	// Start order callbacks delivery
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		webhooks.StartDelivery(ctx)
+	}()
+
+	// Expire abandoned orders
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		service.ReapOrders(ctx, *reapInterval)
+	}()
+
+	// Persist pending orders
+	if orders != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ticker := time.NewTicker(*ordersInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := service.SaveOrders(orders); err != nil {
+						logger.Printf("could not persist pending orders: %v", err)
+					}
+				}
+			}
+		}()
+	}
+
 	<-ctx.Done()
 	wg.Wait()
 
+	for _, line := range plant.Lines() {
+		logger.Printf("production line %d: produced %d unicorns at rate %v, dropped %d", line.ID, line.Produced, line.Rate, line.Dropped)
+	}
+	logger.Printf("build line: built %d custom unicorns", builds.Built())
+	logger.Printf("logistics: dropped %d unicorns given back by cancelled orders", logictics.Dropped())
+
+	if orders != nil {
+		if err := service.SaveOrders(orders); err != nil {
+			logger.Printf("could not persist pending orders: %v", err)
+		}
+	}
+
 	logger.Printf("by by, from unicorn application")
 }
+
+// parseRates returns the production rate of n lines, from comma separated durations.
+// Lines without a rate use the default one.
+func parseRates(s string, n int, rate time.Duration) ([]time.Duration, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid number of lines %d", n)
+	}
+
+	rates := make([]time.Duration, n)
+	for i := range rates {
+		rates[i] = rate
+	}
+
+	if s == "" {
+		return rates, nil
+	}
+
+	for i, r := range strings.Split(s, ",") {
+		if i == n {
+			return nil, fmt.Errorf("more rates than the %d lines", n)
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(r))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate of line %d: %w", i+1, err)
+		}
+		rates[i] = d
+	}
+
+	return rates, nil
+}
+
+// parseAllocation returns the production allocation strategy with the given name.
+func parseAllocation(name string, width int) (app.Allocation, error) {
+	if width < 1 {
+		return nil, fmt.Errorf("invalid allocation width %d", width)
+	}
+
+	switch name {
+	case "fifo":
+		return app.FIFO(), nil
+	case "round-robin":
+		return app.RoundRobin(width), nil
+	case "proportional":
+		return app.Proportional(width), nil
+	default:
+		return nil, fmt.Errorf("unknown allocation %q", name)
+	}
+}
+
+// parseOrderIDs returns the order ID generator with the given name, drawing from src.
+func parseOrderIDs(name string, src io.Reader) (app.IDGenerator, error) {
+	switch name {
+	case "random":
+		return app.NewRandomIDs(app.OrderIDLength, src), nil
+	case "ulid":
+		return app.NewULIDs(src), nil
+	case "uuid":
+		return app.NewUUIDs(src), nil
+	default:
+		return nil, fmt.Errorf("unknown order ID format %q", name)
+	}
+}
+
+// openStorage opens the unicorn storage of the given kind.
+// The returned function must be called to release the storage resources.
+func openStorage(kind, path string, options ...storage.Option) (storage.UnicornStorage, func() error, error) {
+	switch kind {
+	case "memory":
+		return lifo.New(options...), func() error { return nil }, nil
+	case "fifo":
+		return fifo.New(options...), func() error { return nil }, nil
+	case "ranked":
+		return ranked.New(options...), func() error { return nil }, nil
+	case "disk":
+		store, err := disk.Open(path, options...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown storage %q", kind)
+	}
+}
@@ -1,22 +0,0 @@
-package factory
-
-// Available unicorn capabilities. DO NOT had duplicated capabilities.
-var capabilities = [...]string{
-	"super strong",
-	"fullfill wishes",
-	"fighting capabilities",
-	"fly",
-	"swim",
-	"sing",
-	"run",
-	"cry",
-	"change color",
-	"talk",
-	"dance",
-	"code",
-	"design",
-	"drive",
-	"walk",
-	"talk chinese",
-	"lazy",
-}
@@ -0,0 +1,69 @@
+package factory
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Longest capability in a catalog.
+const maxCapabilityLength = 32
+
+var (
+	ErrBlankCapability      = errors.New("blank capability")
+	ErrPaddedCapability     = errors.New("capability with surrounding whitespace")
+	ErrDuplicatedCapability = errors.New("duplicated capability")
+	ErrCapabilityTooLong    = fmt.Errorf("capability longer than %d characters", maxCapabilityLength)
+)
+
+// tierSeparator separates a capability from its tier in a catalog line.
+const tierSeparator = ":"
+
+// loadCatalog loads a line separated capability catalog from the file name,
+// rejecting blank lines, duplicates, over-long capabilities and capabilities
+// with surrounding whitespace, that could not be told apart from the trimmed ones.
+// Each line may give the capability tier, such as "fly:rare". Capabilities are common by default.
+// Errors report the file and line of the invalid capability.
+func loadCatalog(r io.Reader, name string) ([]string, map[string]Tier, error) {
+	var (
+		cap   []string
+		tiers = make(map[string]Tier)
+		seen  = make(map[string]int) // line of each capability
+	)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		c, t, tiered := strings.Cut(scanner.Text(), tierSeparator)
+
+		tier := Common
+		if tiered {
+			var err error
+			if tier, err = ParseTier(t); err != nil {
+				return nil, nil, fmt.Errorf("%s:%d: %w", name, line, err)
+			}
+		}
+
+		switch first, ok := seen[c]; {
+		case strings.TrimSpace(c) == "":
+			return nil, nil, fmt.Errorf("%s:%d: %w", name, line, ErrBlankCapability)
+		case strings.TrimSpace(c) != c:
+			return nil, nil, fmt.Errorf("%s:%d: %w: %q", name, line, ErrPaddedCapability, c)
+		case len(c) > maxCapabilityLength:
+			return nil, nil, fmt.Errorf("%s:%d: %w: %q", name, line, ErrCapabilityTooLong, c)
+		case ok:
+			return nil, nil, fmt.Errorf("%s:%d: %w: %q, first on line %d", name, line, ErrDuplicatedCapability, c, first)
+		}
+
+		seen[c] = line
+		cap = append(cap, c)
+		tiers[c] = tier
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return cap, tiers, nil
+}
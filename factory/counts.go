@@ -0,0 +1,130 @@
+package factory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidCapabilityCount = errors.New("invalid number of capabilities")
+)
+
+// CapabilityRange attributes between min and max capabilities to a unicorn,
+// every number being equally likely.
+func CapabilityRange(min, max int) Option {
+	return func(f *factory) error {
+		if min > max {
+			return fmt.Errorf("%w: range %d-%d", ErrInvalidCapabilityCount, min, max)
+		}
+
+		counts := make(map[int]int, max-min+1)
+		for n := min; n <= max; n++ {
+			counts[n] = 1
+		}
+
+		return CapabilityCounts(counts)(f)
+	}
+}
+
+// CapabilityCounts sets the chance of attributing each number of capabilities to a unicorn,
+// relative to the others. Numbers with zero weight are never attributed.
+// New fails with ErrNotEnoughCapabilities if the catalog has fewer capabilities
+// than the largest number.
+func CapabilityCounts(weights map[int]int) Option {
+	return func(f *factory) error {
+		counts := make(map[int]int, len(weights))
+		for n, w := range weights {
+			if n < 0 {
+				return fmt.Errorf("%w: %d", ErrInvalidCapabilityCount, n)
+			}
+			if w < 0 {
+				return fmt.Errorf("%w: weight %d for %d", ErrInvalidCapabilityCount, w, n)
+			}
+			counts[n] = w
+		}
+
+		f.counts = counts
+		return nil
+	}
+}
+
+// ParseCapabilityCounts parses the numbers of capabilities to attribute to a unicorn,
+// as a single number such as "3", a range such as "1-5", or comma separated
+// weighted numbers such as "1:5,2:3,3:1".
+func ParseCapabilityCounts(s string) (map[int]int, error) {
+	invalid := fmt.Errorf("%w: %q", ErrInvalidCapabilityCount, s)
+
+	if min, max, ok := strings.Cut(s, "-"); ok {
+		from, err := strconv.Atoi(strings.TrimSpace(min))
+		if err != nil {
+			return nil, invalid
+		}
+		to, err := strconv.Atoi(strings.TrimSpace(max))
+		if err != nil || from > to {
+			return nil, invalid
+		}
+
+		counts := make(map[int]int, to-from+1)
+		for n := from; n <= to; n++ {
+			counts[n] = 1
+		}
+		return counts, nil
+	}
+
+	counts := make(map[int]int)
+	for _, entry := range strings.Split(s, ",") {
+		count, weight, weighted := strings.Cut(entry, ":")
+
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil || n < 0 {
+			return nil, invalid
+		}
+
+		w := 1
+		if weighted {
+			if w, err = strconv.Atoi(strings.TrimSpace(weight)); err != nil || w < 0 {
+				return nil, invalid
+			}
+		}
+
+		if _, ok := counts[n]; ok {
+			return nil, invalid
+		}
+		counts[n] = w
+	}
+
+	return counts, nil
+}
+
+// countChances returns the numbers of capabilities that can be attributed, in ascending order,
+// and the sum of their weights.
+func countChances(counts map[int]int) ([]int, int) {
+	var (
+		ns    []int
+		total int
+	)
+
+	for n, w := range counts {
+		if w > 0 {
+			ns = append(ns, n)
+			total += w
+		}
+	}
+	sort.Ints(ns)
+
+	return ns, total
+}
+
+// pickCount picks a random number of capabilities to attribute to a unicorn, by their weights.
+func (f factory) pickCount() int {
+	n := f.rand.Intn(f.totalCount)
+	for _, count := range f.nCaps {
+		if n -= f.counts[count]; n < 0 {
+			return count
+		}
+	}
+	return f.nCaps[len(f.nCaps)-1]
+}
@@ -2,12 +2,20 @@ package factory
 
 import (
 	"bufio"
+	cryptorand "crypto/rand"
 	"embed"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 	"unicorn"
+	"unicorn/pkg/syncrand"
 )
 
 //go:embed fixtures/*.txt
@@ -18,65 +26,156 @@ const (
 	defaultAdjective = "courageous"
 
 	defaultNCapabilities = 3
+
+	// attempts at selecting random capabilities satisfying the rules, before using the fallback.
+	maxSelectAttempts = 100
+
+	// capabilities tried when searching for a selection satisfying the rules, before giving up.
+	// bounds the search, which is exponential in the worst case and runs when validating order filters.
+	maxSearchSteps = 10000
+
+	maxNamePrefix = 32
 )
 
 var (
 	ErrNotEnoughCapabilities = errors.New("not enough capabilities for producing unicorns")
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
 // Factory can produce new unicorns.
 type Factory interface {
 	NewUnicorn() *unicorn.Unicorn
 }
 
+// Catalog can tell the unicorns a factory produces.
+type Catalog interface {
+	// ValidateFilter checks that unicorns matching the filter are produced.
+	ValidateFilter(filter unicorn.CapabilityFilter) error
+}
+
+// Builder can build unicorns to a spec.
+type Builder interface {
+	// Validate checks that unicorns can be built to the spec.
+	Validate(spec unicorn.Spec) error
+
+	// Build builds a unicorn to the spec.
+	Build(spec unicorn.Spec) (*unicorn.Unicorn, error)
+}
+
 type factory struct {
+	// files of the data for unicorn generation
+	fixturesDir  string // overriding the embedded fixtures. not overridden if empty.
+	capabilities string // path of the capability catalog. read from the fixtures if empty.
+	rulesFile    string // path of the capability rules. read along with the catalog if empty.
+
 	// data for unicorn generation
 	names []string
 	adj   []string
 	cap   []string
+	tiers map[string]Tier // of the capabilities
+
+	// chance of attributing the capabilities of each tier, and their rarity score
+	weights map[Tier]int
+	scores  map[Tier]int
+
+	// rules constraining the capabilities attributed together
+	rules    []Rule
+	ruleSet  *ruleSet
+	fallback map[int][]string // capabilities satisfying the rules for each number, for when random selection fails
 
-	// number of capabilities to attribute to a unicorn
-	nCap int
+	// chance of attributing each number of capabilities to a unicorn
+	counts     map[int]int
+	nCaps      []int // numbers with a chance, in ascending order
+	totalCount int   // sum of the chances
+
+	// names given to unicorns. names are not unique if nil.
+	given *nameRegistry
+
+	// source of every random pick, safe for concurrent use
+	rand *rand.Rand
 }
 
-var _ Factory = (*factory)(nil)
+var (
+	_ Factory = (*factory)(nil)
+	_ Builder = (*factory)(nil)
+	_ Catalog = (*factory)(nil)
+)
 
 // Option is function used to customize the factory.
 type Option func(*factory) error
 
-// NCapabilities sets the number of capabilities to attribute to a unicorn.
+// NCapabilities attributes exactly n capabilities to every unicorn.
+// New fails with ErrNotEnoughCapabilities if the catalog has fewer capabilities.
 func NCapabilities(n int) Option {
+	return CapabilityCounts(map[int]int{n: 1})
+}
+
+// FixturesDir loads the data for unicorn generation from a directory:
+// petnames.txt, adj.txt and capabilities.txt. Files missing in the directory
+// are loaded from the embedded fixtures.
+func FixturesDir(dir string) Option {
 	return func(f *factory) error {
-		if len(f.cap) < n {
-			return ErrNotEnoughCapabilities
+		info, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("fixtures %s: not a directory", dir)
 		}
 
-		f.nCap = n
+		f.fixturesDir = dir
 		return nil
 	}
 }
 
-// New creates a new unicorn factory.
-func New(options ...Option) (*factory, error) {
-	names, err := load(fixtures, "fixtures/petnames.txt")
-	if err != nil {
-		return nil, err
+// CapabilitiesFile loads the capability catalog from a line separated file.
+func CapabilitiesFile(path string) Option {
+	return func(f *factory) error {
+		f.capabilities = path
+		return nil
 	}
+}
 
-	adj, err := load(fixtures, "fixtures/adj.txt")
-	if err != nil {
-		return nil, err
+// Seed seeds the random picks of the factory, so that factories created with the same
+// seed and options produce the same sequence of unicorns, save for their IDs and creation time.
+// Unicorns produced concurrently are only reproduced if produced in the same order.
+func Seed(seed int64) Option {
+	return func(f *factory) error {
+		f.rand = syncrand.NewSeeded(seed)
+		return nil
+	}
+}
+
+// WithRand makes the factory draw its random picks from r.
+// r must not be used elsewhere afterwards.
+func WithRand(r *rand.Rand) Option {
+	return func(f *factory) error {
+		f.rand = syncrand.New(r)
+		return nil
+	}
+}
+
+// UniqueNames guarantees that no two unicorns produced by the factory share a name,
+// suffixing the names that were already given.
+func UniqueNames() Option {
+	return func(f *factory) error {
+		f.given = newNameRegistry()
+		return nil
 	}
+}
 
+// New creates a new unicorn factory.
+func New(options ...Option) (*factory, error) {
 	f := &factory{
-		names: names,
-		adj:   adj,
-		cap:   capabilities[:],
-		nCap:  defaultNCapabilities,
+		weights: make(map[Tier]int, len(defaultTierWeights)),
+		scores:  make(map[Tier]int, len(defaultTierScores)),
+		counts:  map[int]int{defaultNCapabilities: 1},
+	}
+
+	for t, w := range defaultTierWeights {
+		f.weights[t] = w
+	}
+	for t, s := range defaultTierScores {
+		f.scores[t] = s
 	}
 
 	for _, opt := range options {
@@ -87,8 +186,54 @@ func New(options ...Option) (*factory, error) {
 		}
 	}
 
-	if len(f.cap) < f.nCap {
-		return nil, ErrNotEnoughCapabilities
+	if f.rand == nil {
+		f.rand = syncrand.NewRandom()
+	}
+
+	var err error
+
+	if f.names, err = f.load("petnames.txt"); err != nil {
+		return nil, err
+	}
+
+	if f.adj, err = f.load("adj.txt"); err != nil {
+		return nil, err
+	}
+
+	if f.cap, f.tiers, err = f.loadCapabilities(); err != nil {
+		return nil, err
+	}
+
+	if f.nCaps, f.totalCount = countChances(f.counts); len(f.nCaps) == 0 {
+		return nil, fmt.Errorf("%w: no number has a chance", ErrInvalidCapabilityCount)
+	}
+
+	// capabilities of tiers with zero weight are never attributed.
+	attributable := 0
+	for _, c := range f.cap {
+		if f.weight(c) > 0 {
+			attributable++
+		}
+	}
+
+	if max := f.nCaps[len(f.nCaps)-1]; attributable < max {
+		return nil, fmt.Errorf("%w: %d attributable for %d per unicorn", ErrNotEnoughCapabilities, attributable, max)
+	}
+
+	rules, err := f.loadRules()
+	if err != nil {
+		return nil, err
+	}
+
+	if f.ruleSet, err = newRuleSet(append(rules, f.rules...), f.cap); err != nil {
+		return nil, err
+	}
+
+	f.fallback = make(map[int][]string, len(f.nCaps))
+	for _, n := range f.nCaps {
+		if f.fallback[n] = f.findSelection(n, unicorn.CapabilityFilter{}); f.fallback[n] == nil {
+			return nil, fmt.Errorf("%w with %d capabilities", ErrUnsatisfiableRules, n)
+		}
 	}
 
 	return f, nil
@@ -96,65 +241,392 @@ func New(options ...Option) (*factory, error) {
 
 // NewUnicorn produces a new unicorn.
 func (f factory) NewUnicorn() *unicorn.Unicorn {
+	caps := f.selectCapabilities()
+
+	return &unicorn.Unicorn{
+		ID:           newID(),
+		Name:         f.uniqueName(f.getRandomName()),
+		Capabilities: caps,
+		Rarity:       f.rarity(caps),
+		CreatedAt:    time.Now(),
+	}
+}
+
+// Validate checks that unicorns can be built to the spec:
+// with distinct capabilities from the factory ones, and a short name prefix without spaces.
+func (f factory) Validate(spec unicorn.Spec) error {
+	if len(spec.Capabilities) == 0 {
+		return fmt.Errorf("%w: no capabilities", unicorn.ErrInvalidSpec)
+	}
+
+	seen := make(map[string]struct{}, len(spec.Capabilities))
+	for _, c := range spec.Capabilities {
+		if _, ok := seen[c]; ok {
+			return fmt.Errorf("%w: duplicated capability %q", unicorn.ErrInvalidSpec, c)
+		}
+		seen[c] = struct{}{}
+
+		if !f.hasCapability(c) {
+			return fmt.Errorf("%w: unknown capability %q", unicorn.ErrInvalidSpec, c)
+		}
+	}
+
+	if err := f.ruleSet.check(spec.Capabilities); err != nil {
+		return fmt.Errorf("%w: %v", unicorn.ErrInvalidSpec, err)
+	}
+
+	if len(spec.NamePrefix) > maxNamePrefix || strings.ContainsAny(spec.NamePrefix, " \t\n") {
+		return fmt.Errorf("%w: invalid name prefix %q", unicorn.ErrInvalidSpec, spec.NamePrefix)
+	}
+
+	return nil
+}
+
+// ValidateFilter checks that the factory produces unicorns matching the filter:
+// with capabilities from the factory ones, the required ones attributed together
+// without the excluded ones. Filters for which no unicorn is found within a bounded search are refused,
+// so that validating them stays cheap whatever the catalog and rules.
+func (f factory) ValidateFilter(filter unicorn.CapabilityFilter) error {
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+
+	for _, caps := range [][]string{filter.Required, filter.Excluded} {
+		for _, c := range caps {
+			if !f.hasCapability(c) {
+				return fmt.Errorf("%w: unknown capability %q", unicorn.ErrInvalidFilter, c)
+			}
+		}
+	}
+
+	for _, n := range f.nCaps {
+		if f.findSelection(n, filter) != nil {
+			return nil
+		}
+	}
+
+	matching := fmt.Sprintf("with %q", filter.Required)
+	if len(filter.Excluded) > 0 {
+		matching += fmt.Sprintf(" without %q", filter.Excluded)
+	}
+
+	return fmt.Errorf("%w: no unicorn is produced %s", unicorn.ErrInvalidFilter, matching)
+}
+
+// Build builds a unicorn to the spec.
+func (f factory) Build(spec unicorn.Spec) (*unicorn.Unicorn, error) {
+	if err := f.Validate(spec); err != nil {
+		return nil, err
+	}
+
+	prefix := spec.NamePrefix
+	if prefix == "" {
+		prefix = f.getRandomAdjective()
+	}
+
 	return &unicorn.Unicorn{
-		Name:         f.getRandomName(),
-		Capabilities: f.selectCapabilities(),
+		ID:           newID(),
+		Name:         f.uniqueName(fmt.Sprintf("%s-%s", prefix, f.getRandomPetname())),
+		Capabilities: append([]string(nil), spec.Capabilities...),
+		Rarity:       f.rarity(spec.Capabilities),
+		CreatedAt:    time.Now(),
+	}, nil
+}
+
+// hasCapability reports whether the factory can attribute a capability.
+func (f factory) hasCapability(capability string) bool {
+	for _, c := range f.cap {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueName makes a name unique, if the factory gives unique names.
+func (f factory) uniqueName(name string) string {
+	if f.given == nil {
+		return name
+	}
+	return f.given.unique(name)
+}
+
+// newID generates a random unicorn ID of 32 hexadecimal characters.
+// IDs are drawn from the cryptographically secure generator, not from the factory picks,
+// so that seeded factories reproduce the unicorns without ever reusing their IDs.
+func newID() string {
+	var b [16]byte
+	if _, err := cryptorand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("factory: generating unicorn ID: %v", err))
 	}
+	return hex.EncodeToString(b[:])
 }
 
 // getRandomName generates a random name from the list of adjectives and names.
 func (f factory) getRandomName() string {
-	name := defaultName
-	if len(f.names) != 0 {
-		name = f.names[rand.Intn(len(f.names))]
-	}
+	return fmt.Sprintf("%s-%s", f.getRandomAdjective(), f.getRandomPetname())
+}
 
-	adj := defaultAdjective
-	if len(f.adj) != 0 {
-		adj = f.adj[rand.Intn(len(f.adj))]
+// getRandomPetname picks a random name from the list of names.
+func (f factory) getRandomPetname() string {
+	if len(f.names) == 0 {
+		return defaultName
 	}
+	return f.names[f.rand.Intn(len(f.names))]
+}
 
-	return fmt.Sprintf("%s-%s", adj, name)
+// getRandomAdjective picks a random adjective from the list of adjectives.
+func (f factory) getRandomAdjective() string {
+	if len(f.adj) == 0 {
+		return defaultAdjective
+	}
+	return f.adj[f.rand.Intn(len(f.adj))]
 }
 
-// selectCapabilities select capabilities to give to a unicorn.
+// selectCapabilities select capabilities to give to a unicorn, by the weight of their tiers,
+// along with the capabilities they require and never with the ones they exclude.
+// The number of capabilities is picked at random as well.
 func (f factory) selectCapabilities() []string {
-	cmap := make(map[string]struct{})
+	n := f.pickCount()
 
-	for i := 0; i < f.nCap; {
-		c := f.cap[rand.Intn(len(f.cap))]
+	for attempt := 0; attempt < maxSelectAttempts; attempt++ {
+		if caps, ok := f.trySelectCapabilities(n); ok {
+			return caps
+		}
+	}
+
+	return append([]string(nil), f.fallback[n]...)
+}
+
+// trySelectCapabilities picks random capabilities until the unicorn has n.
+// It fails if the picked capabilities leave no other to complete them.
+func (f factory) trySelectCapabilities(n int) ([]string, bool) {
+	caps := make([]string, 0, n)
+	selected := make(map[string]struct{}, n)
+
+	for len(caps) < n {
+		var (
+			candidates []string
+			total      int
+		)
+
+		for _, c := range f.cap {
+			if w := f.weight(c); w > 0 && f.fits(selected, c, n) {
+				candidates = append(candidates, c)
+				total += w
+			}
+		}
+
+		if total == 0 {
+			return nil, false
+		}
 
-		if _, ok := cmap[c]; !ok {
-			cmap[c] = struct{}{}
-			i++
+		pick := f.rand.Intn(total)
+		for _, c := range candidates {
+			if pick -= f.weight(c); pick < 0 {
+				caps = f.add(caps, selected, c)
+				break
+			}
 		}
 	}
 
-	caps := make([]string, 0, len(cmap))
-	for c := range cmap {
-		caps = append(caps, c)
+	return caps, true
+}
+
+// fits reports whether a capability can be attributed along with the selected ones,
+// with the capabilities it requires, without exceeding n capabilities.
+func (f factory) fits(selected map[string]struct{}, capability string, n int) bool {
+	if _, ok := selected[capability]; ok {
+		return false
+	}
+
+	missing := f.missing(selected, capability)
+	if len(selected)+len(missing) > n {
+		return false
+	}
+
+	_, _, conflict := f.ruleSet.conflict(selected, missing)
+	return !conflict
+}
+
+// missing returns the capability and the ones it requires, that are not selected.
+func (f factory) missing(selected map[string]struct{}, capability string) []string {
+	var missing []string
+	for _, c := range f.ruleSet.closures[capability] {
+		if _, ok := selected[c]; !ok {
+			missing = append(missing, c)
+		}
 	}
+	return missing
+}
 
+// add selects a capability, with the ones it requires.
+func (f factory) add(caps []string, selected map[string]struct{}, capability string) []string {
+	for _, c := range f.missing(selected, capability) {
+		selected[c] = struct{}{}
+		caps = append(caps, c)
+	}
 	return caps
 }
 
-// load line separated strings from a embeded text file.
-func load(fs embed.FS, name string) ([]string, error) {
-	f, err := fs.Open(name)
+// findSelection searches for n capabilities that random selection could attribute to a unicorn,
+// satisfying the rules and matching the filter. It returns nil if there are none,
+// or if none was found within maxSearchSteps.
+func (f factory) findSelection(n int, filter unicorn.CapabilityFilter) []string {
+	caps := make([]string, 0, n)
+	selected := make(map[string]struct{}, n)
+
+	// the required capabilities are selected first, leaving only the others to search.
+	for _, r := range filter.Required {
+		if _, ok := selected[r]; ok {
+			continue
+		}
+		if f.weight(r) == 0 || !f.fits(selected, r, n) || f.excluded(selected, r, filter) {
+			return nil
+		}
+		caps = f.add(caps, selected, r)
+	}
+
+	steps := 0
+
+	var search func(caps []string, from int) []string
+	search = func(caps []string, from int) []string {
+		if len(caps) == n {
+			return caps
+		}
+
+		for i := from; i < len(f.cap); i++ {
+			if steps++; steps > maxSearchSteps {
+				return nil
+			}
+
+			c := f.cap[i]
+			if f.weight(c) == 0 || !f.fits(selected, c, n) || f.excluded(selected, c, filter) {
+				continue
+			}
+
+			missing := f.missing(selected, c)
+			if found := search(f.add(caps, selected, c), i+1); found != nil {
+				return found
+			}
+
+			for _, m := range missing {
+				delete(selected, m)
+			}
+		}
+
+		return nil
+	}
+
+	return search(caps, 0)
+}
+
+// excluded reports whether selecting a capability would select one the filter excludes.
+func (f factory) excluded(selected map[string]struct{}, capability string, filter unicorn.CapabilityFilter) bool {
+	for _, m := range f.missing(selected, capability) {
+		for _, e := range filter.Excluded {
+			if m == e {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// weight returns the chance of attributing a capability, relative to the others.
+func (f factory) weight(capability string) int {
+	return f.weights[f.tiers[capability]]
+}
+
+// rarity computes the rarity score of a unicorn with the capabilities, adding their tier scores.
+func (f factory) rarity(capabilities []string) int {
+	score := 0
+	for _, c := range capabilities {
+		score += f.scores[f.tiers[c]]
+	}
+	return score
+}
+
+// loadCapabilities loads the capability catalog, from the capabilities file or the fixtures.
+func (f *factory) loadCapabilities() ([]string, map[string]Tier, error) {
+	var (
+		file io.ReadCloser
+		name = f.capabilities
+		err  error
+	)
+
+	if name == "" {
+		file, name, err = f.openFixture("capabilities.txt")
+	} else {
+		file, err = os.Open(name)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	return loadCatalog(file, name)
+}
+
+// loadRules loads the capability rules, from the rules file or else along with the catalog:
+// from the fixtures, unless the catalog is loaded from a capabilities file.
+func (f *factory) loadRules() ([]Rule, error) {
+	var (
+		file io.ReadCloser
+		name = f.rulesFile
+		err  error
+	)
+
+	switch {
+	case name != "":
+		file, err = os.Open(name)
+	case f.capabilities == "":
+		file, name, err = f.openFixture("rules.txt")
+	default:
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	defer file.Close()
 
-	var cap []string
-	scanner := bufio.NewScanner(f)
+	return loadRules(file, name)
+}
+
+// load line separated strings from a fixture file.
+func (f *factory) load(name string) ([]string, error) {
+	file, _, err := f.openFixture(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		cap = append(cap, scanner.Text())
+		lines = append(lines, scanner.Text())
 	}
 
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
 
-	return cap, nil
+	return lines, nil
+}
+
+// openFixture opens a fixture file from the fixtures directory, or else the embedded one.
+// It also returns the path of the opened file.
+func (f *factory) openFixture(name string) (io.ReadCloser, string, error) {
+	if f.fixturesDir != "" {
+		path := filepath.Join(f.fixturesDir, name)
+
+		file, err := os.Open(path)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return file, path, err
+		}
+	}
+
+	path := "fixtures/" + name
+	file, err := fixtures.Open(path)
+	return file, path, err
 }
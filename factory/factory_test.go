@@ -0,0 +1,204 @@
+package factory
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"unicorn"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// golden is what a seeded factory reproduces of a unicorn.
+type golden struct {
+	Name         string   `json:"name"`
+	Capabilities []string `json:"capabilities"`
+	Rarity       int      `json:"rarity"`
+}
+
+func TestSeededGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+	}{
+		{"default", nil},
+		{"capability-range", []Option{CapabilityRange(1, 5)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := produce(t, 20, append(tt.options, Seed(42))...)
+
+			path := filepath.Join("testdata", "seeded-"+tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("reading golden file, run with -update to create it: %v", err)
+			}
+
+			if !bytes.Equal(got, want) {
+				t.Errorf("seeded unicorns differ from %s:\ngot:\n%s\nwant:\n%s", path, got, want)
+			}
+		})
+	}
+}
+
+func TestSeededReproducible(t *testing.T) {
+	first := produce(t, 50, Seed(7), CapabilityRange(2, 4))
+	second := produce(t, 50, Seed(7), CapabilityRange(2, 4))
+
+	if !bytes.Equal(first, second) {
+		t.Errorf("factories with the same seed produced different unicorns:\n%s\n%s", first, second)
+	}
+}
+
+func TestSeededUniqueIDs(t *testing.T) {
+	seen := make(map[string]struct{})
+
+	for run := 0; run < 2; run++ {
+		f, err := New(Seed(42))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 10; i++ {
+			u := f.NewUnicorn()
+			if _, ok := seen[u.ID]; ok {
+				t.Fatalf("seeded factories reused the unicorn ID %s", u.ID)
+			}
+			seen[u.ID] = struct{}{}
+		}
+	}
+}
+
+func TestUniqueNames(t *testing.T) {
+	dir := t.TempDir()
+
+	// a single adjective and petname, so that every unicorn gets the same name.
+	for file, content := range map[string]string{"adj.txt": "edible\n", "petnames.txt": "celinda\n"} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := New(FixturesDir(dir), UniqueNames())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"edible-celinda", "edible-celinda-2", "edible-celinda-3"} {
+		if got := f.NewUnicorn().Name; got != want {
+			t.Errorf("name %q, want %q", got, want)
+		}
+	}
+}
+
+func TestValidateFilter(t *testing.T) {
+	f, err := New(Seed(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		filter unicorn.CapabilityFilter
+		valid  bool
+	}{
+		{unicorn.CapabilityFilter{Required: []string{"fly"}}, true},
+		{unicorn.CapabilityFilter{Required: []string{"talk chinese"}}, true},
+		{unicorn.CapabilityFilter{Required: []string{"teleport"}}, false},
+		{unicorn.CapabilityFilter{Excluded: []string{"teleport"}}, false},
+		{unicorn.CapabilityFilter{Required: []string{"lazy", "super strong"}}, false},
+		{unicorn.CapabilityFilter{Required: []string{"talk chinese"}, Excluded: []string{"talk"}}, false},
+	}
+
+	for _, tt := range tests {
+		err := f.ValidateFilter(tt.filter)
+		if tt.valid && err != nil {
+			t.Errorf("ValidateFilter(%+v) = %v, want nil", tt.filter, err)
+		}
+		if !tt.valid && !errors.Is(err, unicorn.ErrInvalidFilter) {
+			t.Errorf("ValidateFilter(%+v) = %v, want %v", tt.filter, err, unicorn.ErrInvalidFilter)
+		}
+	}
+}
+
+func TestValidateFilterBounded(t *testing.T) {
+	dir := t.TempDir()
+
+	// unicorns have one capability of each pair, so excluding a whole pair leaves too few:
+	// an unbounded search would try every selection from the other pairs.
+	const pairs = 30
+
+	var capabilities, rules bytes.Buffer
+	for i := 0; i < pairs; i++ {
+		fmt.Fprintf(&capabilities, "a%d\nb%d\n", i, i)
+		fmt.Fprintf(&rules, "a%d excludes b%d\n", i, i)
+	}
+
+	capabilitiesFile := filepath.Join(dir, "capabilities.txt")
+	rulesFile := filepath.Join(dir, "rules.txt")
+	if err := os.WriteFile(capabilitiesFile, capabilities.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(rulesFile, rules.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := New(CapabilitiesFile(capabilitiesFile), RulesFile(rulesFile), NCapabilities(pairs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- f.ValidateFilter(unicorn.CapabilityFilter{Excluded: []string{"a0", "b0"}})
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, unicorn.ErrInvalidFilter) {
+			t.Errorf("ValidateFilter() = %v, want %v", err, unicorn.ErrInvalidFilter)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the filter validation did not return")
+	}
+
+	// the required capabilities are selected upfront, so the search for them is short.
+	required := unicorn.CapabilityFilter{Required: []string{"b29", "b28", "a27"}, Excluded: []string{"a0"}}
+	if err := f.ValidateFilter(required); err != nil {
+		t.Errorf("ValidateFilter(%+v) = %v, want nil", required, err)
+	}
+}
+
+// produce returns n unicorns from a new factory, encoded one per line without their ID and creation time.
+func produce(t *testing.T, n int, options ...Option) []byte {
+	t.Helper()
+
+	f, err := New(options...)
+	if err != nil {
+		t.Fatalf("creating factory: %v", err)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+
+	for i := 0; i < n; i++ {
+		u := f.NewUnicorn()
+		if err := enc.Encode(golden{Name: u.Name, Capabilities: u.Capabilities, Rarity: u.Rarity}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return buf.Bytes()
+}
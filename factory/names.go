@@ -0,0 +1,31 @@
+package factory
+
+import (
+	"fmt"
+	"sync"
+)
+
+// nameRegistry keeps track of the names given to unicorns, to keep them unique.
+type nameRegistry struct {
+	mu    sync.Mutex
+	given map[string]int // number of unicorns given each name
+}
+
+func newNameRegistry() *nameRegistry {
+	return &nameRegistry{
+		given: make(map[string]int),
+	}
+}
+
+// unique returns the name if it was never given, or else the name suffixed
+// with the number of times it was given, such as "lazy-spirit-2".
+func (r *nameRegistry) unique(name string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.given[name]++
+	if n := r.given[name]; n > 1 {
+		return fmt.Sprintf("%s-%d", name, n)
+	}
+	return name
+}
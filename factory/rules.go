@@ -0,0 +1,248 @@
+package factory
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	ErrInvalidRule        = errors.New("invalid capability rule")
+	ErrConflictingRules   = errors.New("conflicting capability rules")
+	ErrUnsatisfiableRules = errors.New("capability rules can not be satisfied")
+)
+
+type ruleKind int
+
+const (
+	requires ruleKind = iota // the capability is only attributed along with the other.
+	excludes                 // the capabilities are never attributed together.
+)
+
+var ruleKeywords = map[ruleKind]string{
+	requires: "requires",
+	excludes: "excludes",
+}
+
+// Rule constrains the capabilities attributed together to a unicorn.
+type Rule struct {
+	kind       ruleKind
+	capability string
+	other      string
+
+	origin string // where the rule was defined, such as "rules.txt:3". empty if given as an option.
+}
+
+// Requires only attributes a capability along with the required one.
+func Requires(capability, required string) Rule {
+	return Rule{kind: requires, capability: capability, other: required}
+}
+
+// Excludes never attributes two capabilities together.
+func Excludes(capability, excluded string) Rule {
+	return Rule{kind: excludes, capability: capability, other: excluded}
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s %s %s", r.capability, ruleKeywords[r.kind], r.other)
+}
+
+// errorf formats an error about the rule, prefixed by its origin.
+func (r Rule) errorf(format string, a ...any) error {
+	err := fmt.Errorf(format, a...)
+	if r.origin == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", r.origin, err)
+}
+
+// ParseRule parses a rule such as "talk chinese requires talk" or "lazy excludes super strong".
+func ParseRule(s string) (Rule, error) {
+	for kind, keyword := range ruleKeywords {
+		capability, other, ok := strings.Cut(s, " "+keyword+" ")
+		if !ok {
+			continue
+		}
+
+		capability, other = strings.TrimSpace(capability), strings.TrimSpace(other)
+		if capability == "" || other == "" {
+			break
+		}
+
+		return Rule{kind: kind, capability: capability, other: other}, nil
+	}
+
+	return Rule{}, fmt.Errorf("%w: %q", ErrInvalidRule, s)
+}
+
+// WithRules adds rules constraining the capabilities attributed together to a unicorn.
+func WithRules(rules ...Rule) Option {
+	return func(f *factory) error {
+		f.rules = append(f.rules, rules...)
+		return nil
+	}
+}
+
+// RulesFile loads the capability rules from a line separated file, instead of the fixtures.
+func RulesFile(path string) Option {
+	return func(f *factory) error {
+		f.rulesFile = path
+		return nil
+	}
+}
+
+// loadRules loads line separated rules from the file name.
+// Blank lines and lines starting with # are ignored.
+func loadRules(r io.Reader, name string) ([]Rule, error) {
+	var rules []Rule
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+
+		rule, err := ParseRule(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		rule.origin = fmt.Sprintf("%s:%d", name, line)
+
+		rules = append(rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// ruleSet enforces the rules among the capabilities of a catalog.
+type ruleSet struct {
+	requires map[string][]string            // capabilities required by each capability
+	excludes map[string]map[string]struct{} // capabilities excluded by each capability
+
+	// each capability followed by every capability it requires, transitively.
+	closures map[string][]string
+}
+
+// newRuleSet validates the rules against the catalog.
+// Every capability in the rules must be in the catalog, and the rules must not
+// make a capability impossible to attribute.
+func newRuleSet(rules []Rule, catalog []string) (*ruleSet, error) {
+	known := make(map[string]struct{}, len(catalog))
+	for _, c := range catalog {
+		known[c] = struct{}{}
+	}
+
+	rs := &ruleSet{
+		requires: make(map[string][]string),
+		excludes: make(map[string]map[string]struct{}),
+		closures: make(map[string][]string, len(catalog)),
+	}
+
+	for _, r := range rules {
+		for _, c := range []string{r.capability, r.other} {
+			if _, ok := known[c]; !ok {
+				return nil, r.errorf("%w: unknown capability %q in %q", ErrInvalidRule, c, r)
+			}
+		}
+
+		if r.capability == r.other {
+			return nil, r.errorf("%w: %q refers to a single capability", ErrInvalidRule, r)
+		}
+
+		switch r.kind {
+		case requires:
+			rs.requires[r.capability] = append(rs.requires[r.capability], r.other)
+		case excludes:
+			rs.exclude(r.capability, r.other)
+			rs.exclude(r.other, r.capability)
+		}
+	}
+
+	for _, c := range catalog {
+		closure := rs.closure(c)
+
+		if a, b, ok := rs.conflict(nil, closure); ok {
+			return nil, fmt.Errorf("%w: %q can never be attributed, as %q excludes %q", ErrConflictingRules, c, a, b)
+		}
+
+		rs.closures[c] = closure
+	}
+
+	return rs, nil
+}
+
+// exclude records that a capability excludes another.
+func (rs *ruleSet) exclude(capability, excluded string) {
+	if rs.excludes[capability] == nil {
+		rs.excludes[capability] = make(map[string]struct{})
+	}
+	rs.excludes[capability][excluded] = struct{}{}
+}
+
+// closure returns the capability followed by every capability it requires, transitively.
+func (rs *ruleSet) closure(capability string) []string {
+	closure := []string{capability}
+	seen := map[string]struct{}{capability: {}}
+
+	for i := 0; i < len(closure); i++ {
+		for _, r := range rs.requires[closure[i]] {
+			if _, ok := seen[r]; !ok {
+				seen[r] = struct{}{}
+				closure = append(closure, r)
+			}
+		}
+	}
+
+	return closure
+}
+
+// conflict finds two capabilities excluding each other, once the added ones are
+// attributed along with the selected ones.
+func (rs *ruleSet) conflict(selected map[string]struct{}, added []string) (string, string, bool) {
+	for i, a := range added {
+		excluded := rs.excludes[a]
+
+		for s := range selected {
+			if _, ok := excluded[s]; ok {
+				return a, s, true
+			}
+		}
+
+		for _, b := range added[i+1:] {
+			if _, ok := excluded[b]; ok {
+				return a, b, true
+			}
+		}
+	}
+
+	return "", "", false
+}
+
+// check validates a set of capabilities against the rules.
+func (rs *ruleSet) check(capabilities []string) error {
+	set := make(map[string]struct{}, len(capabilities))
+	for _, c := range capabilities {
+		set[c] = struct{}{}
+	}
+
+	for _, c := range capabilities {
+		for _, r := range rs.requires[c] {
+			if _, ok := set[r]; !ok {
+				return fmt.Errorf("%q requires %q", c, r)
+			}
+		}
+	}
+
+	if a, b, ok := rs.conflict(nil, capabilities); ok {
+		return fmt.Errorf("%q excludes %q", a, b)
+	}
+
+	return nil
+}
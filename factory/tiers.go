@@ -0,0 +1,80 @@
+package factory
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Tier is the rarity of a capability.
+// Rarer capabilities are attributed less often and make unicorns more valuable.
+type Tier int
+
+// Capability tiers.
+const (
+	Common Tier = iota
+	Rare
+	Legendary
+)
+
+var (
+	ErrUnknownTier   = errors.New("unknown capability tier")
+	ErrInvalidWeight = errors.New("invalid capability tier weight")
+)
+
+var tierNames = map[Tier]string{
+	Common:    "common",
+	Rare:      "rare",
+	Legendary: "legendary",
+}
+
+// Default chance of attributing a capability of each tier, relative to the others,
+// and its contribution to the unicorn rarity score.
+var (
+	defaultTierWeights = map[Tier]int{Common: 10, Rare: 3, Legendary: 1}
+	defaultTierScores  = map[Tier]int{Common: 1, Rare: 5, Legendary: 20}
+)
+
+// ParseTier parses a tier name: common, rare or legendary.
+func ParseTier(s string) (Tier, error) {
+	for t, name := range tierNames {
+		if name == s {
+			return t, nil
+		}
+	}
+	return Common, fmt.Errorf("%w %q", ErrUnknownTier, s)
+}
+
+func (t Tier) String() string {
+	if name, ok := tierNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("tier(%d)", int(t))
+}
+
+// TierWeight sets the chance of attributing the capabilities of a tier, relative to the
+// other tiers. Capabilities of a tier with zero weight are never attributed at random.
+func TierWeight(tier Tier, weight int) Option {
+	return func(f *factory) error {
+		if _, ok := tierNames[tier]; !ok {
+			return fmt.Errorf("%w %v", ErrUnknownTier, tier)
+		}
+		if weight < 0 {
+			return fmt.Errorf("%w: %d for %v", ErrInvalidWeight, weight, tier)
+		}
+
+		f.weights[tier] = weight
+		return nil
+	}
+}
+
+// TierScore sets how much the capabilities of a tier add to the unicorn rarity score.
+func TierScore(tier Tier, score int) Option {
+	return func(f *factory) error {
+		if _, ok := tierNames[tier]; !ok {
+			return fmt.Errorf("%w %v", ErrUnknownTier, tier)
+		}
+
+		f.scores[tier] = score
+		return nil
+	}
+}
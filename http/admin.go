@@ -0,0 +1,230 @@
+package http
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicorn"
+)
+
+var (
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrInvalidLineID = errors.New("invalid production line ID")
+	ErrLineNotFound  = errors.New("could not find the production line")
+	ErrInvalidRate   = errors.New("invalid production rate")
+)
+
+// Production line states.
+const (
+	lineRunning = "running"
+	linePaused  = "paused"
+	lineBlocked = "blocked"
+)
+
+type LineResponse struct {
+	ID       int    `json:"id"`
+	State    string `json:"state"` // running, paused or blocked waiting for room in storage.
+	Rate     string `json:"rate"`  // duration, such as "5s".
+	Produced int    `json:"produced"`
+	Dropped  int    `json:"dropped"`
+}
+
+type LinesResponse struct {
+	Lines []LineResponse `json:"lines"`
+}
+
+// RateRequest is the body of a production rate change request.
+type RateRequest struct {
+	Rate string `json:"rate"` // duration, such as "5s".
+}
+
+// WithToken requires requests to be authorized by a bearer token.
+// If the token is empty, requests are not authorized.
+func WithToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// compared in constant time, not to leak how much of the token matched.
+		auth := []byte(r.Header.Get("Authorization"))
+		if token == "" || subtle.ConstantTimeCompare(auth, []byte("Bearer "+token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			raise(w, ErrUnauthorized, http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HandleProduction serves the production lines administration.
+// The path must be relative to the production resource.
+//
+//	GET    /
+//	POST   /
+//	GET    /{id}
+//	DELETE /{id}
+//	POST   /{id}/pause
+//	POST   /{id}/resume
+//	PUT    /{id}/rate
+func HandleProduction(prod unicorn.Production) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, action, _ := strings.Cut(strings.Trim(r.URL.Path, "/"), "/")
+		if p == "" {
+			switch r.Method {
+			case "GET":
+				handleLines(w, prod)
+			case "POST":
+				handleNewLine(w, r, prod)
+			default:
+				notAllowed(w, "GET, POST")
+			}
+			return
+		}
+
+		id, err := strconv.Atoi(p)
+		if err != nil {
+			raise(w, ErrInvalidLineID, http.StatusBadRequest)
+			return
+		}
+
+		switch action {
+		case "":
+			switch r.Method {
+			case "GET":
+			case "DELETE":
+				if err := prod.RemoveLine(id); err != nil {
+					raiseLine(w, err)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			default:
+				notAllowed(w, "GET, DELETE")
+				return
+			}
+		case "pause":
+			if r.Method != "POST" {
+				notAllowed(w, "POST")
+				return
+			}
+			err = prod.Pause(id)
+		case "resume":
+			if r.Method != "POST" {
+				notAllowed(w, "POST")
+				return
+			}
+			err = prod.Resume(id)
+		case "rate":
+			if r.Method != "PUT" {
+				notAllowed(w, "PUT")
+				return
+			}
+
+			rate, ok := getRate(w, r)
+			if !ok {
+				return
+			}
+			err = prod.SetRate(id, rate)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		if err != nil {
+			raiseLine(w, err)
+			return
+		}
+
+		line, err := prod.Line(id)
+		if err != nil {
+			raiseLine(w, err)
+			return
+		}
+
+		reply(w, http.StatusOK, lineResponse(line))
+	}
+}
+
+func handleNewLine(w http.ResponseWriter, r *http.Request, prod unicorn.Production) {
+	rate, ok := getRate(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := prod.NewLine(rate)
+	if err != nil {
+		raiseLine(w, err)
+		return
+	}
+
+	line, err := prod.Line(id)
+	if err != nil {
+		raiseLine(w, err)
+		return
+	}
+
+	reply(w, http.StatusCreated, lineResponse(line))
+}
+
+// getRate decodes the production rate of a request body.
+// If the rate is invalid, it replies with the error and returns false.
+func getRate(w http.ResponseWriter, r *http.Request) (time.Duration, bool) {
+	var req RateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		raise(w, ErrInvalidBody, http.StatusBadRequest)
+		return 0, false
+	}
+
+	rate, err := time.ParseDuration(req.Rate)
+	if err != nil {
+		raise(w, ErrInvalidRate, http.StatusBadRequest)
+		return 0, false
+	}
+
+	return rate, true
+}
+
+func handleLines(w http.ResponseWriter, prod unicorn.Production) {
+	lines := prod.Lines()
+
+	response := LinesResponse{
+		Lines: make([]LineResponse, len(lines)),
+	}
+	for i, line := range lines {
+		response.Lines[i] = lineResponse(line)
+	}
+
+	reply(w, http.StatusOK, &response)
+}
+
+func lineResponse(line unicorn.LineStats) LineResponse {
+	state := lineRunning
+	switch {
+	case line.Paused:
+		state = linePaused
+	case line.Blocked:
+		state = lineBlocked
+	}
+
+	return LineResponse{
+		ID:       line.ID,
+		State:    state,
+		Rate:     line.Rate.String(),
+		Produced: line.Produced,
+		Dropped:  line.Dropped,
+	}
+}
+
+// raiseLine replies to the request with a production error.
+func raiseLine(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, unicorn.ErrLineNotFound):
+		raise(w, ErrLineNotFound, http.StatusNotFound)
+	case errors.Is(err, unicorn.ErrInvalidRate):
+		raise(w, ErrInvalidRate, http.StatusBadRequest)
+	default:
+		raise(w, err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,183 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicorn"
+)
+
+// testProduction is an in-memory production, without actual lines.
+type testProduction struct {
+	lines  map[int]*unicorn.LineStats
+	nextID int
+}
+
+func newTestProduction(rates ...time.Duration) *testProduction {
+	p := &testProduction{lines: make(map[int]*unicorn.LineStats), nextID: 1}
+	for _, rate := range rates {
+		p.NewLine(rate)
+	}
+	return p
+}
+
+func (p *testProduction) Lines() []unicorn.LineStats {
+	var lines []unicorn.LineStats
+	for id := 1; id < p.nextID; id++ {
+		if line, ok := p.lines[id]; ok {
+			lines = append(lines, *line)
+		}
+	}
+	return lines
+}
+
+func (p *testProduction) Line(id int) (unicorn.LineStats, error) {
+	line, ok := p.lines[id]
+	if !ok {
+		return unicorn.LineStats{}, unicorn.ErrLineNotFound
+	}
+	return *line, nil
+}
+
+func (p *testProduction) Pause(id int) error {
+	return p.set(id, func(l *unicorn.LineStats) { l.Paused = true })
+}
+func (p *testProduction) Resume(id int) error {
+	return p.set(id, func(l *unicorn.LineStats) { l.Paused = false })
+}
+
+func (p *testProduction) SetRate(id int, rate time.Duration) error {
+	if rate <= 0 {
+		return unicorn.ErrInvalidRate
+	}
+	return p.set(id, func(l *unicorn.LineStats) { l.Rate = rate })
+}
+
+func (p *testProduction) NewLine(rate time.Duration) (int, error) {
+	if rate <= 0 {
+		return 0, unicorn.ErrInvalidRate
+	}
+	id := p.nextID
+	p.nextID++
+	p.lines[id] = &unicorn.LineStats{ID: id, Rate: rate}
+	return id, nil
+}
+
+func (p *testProduction) RemoveLine(id int) error {
+	if _, ok := p.lines[id]; !ok {
+		return unicorn.ErrLineNotFound
+	}
+	delete(p.lines, id)
+	return nil
+}
+
+func (p *testProduction) set(id int, fn func(*unicorn.LineStats)) error {
+	line, ok := p.lines[id]
+	if !ok {
+		return unicorn.ErrLineNotFound
+	}
+	fn(line)
+	return nil
+}
+
+func TestHandleProduction(t *testing.T) {
+	tests := []struct {
+		method, path, body string
+		status             int
+		want               string // in the response body
+	}{
+		{"GET", "/", "", http.StatusOK, `{"lines":[{"id":1,"state":"running","rate":"5s","produced":0,"dropped":0}]}`},
+		{"GET", "/1", "", http.StatusOK, `"id":1`},
+		{"GET", "/2", "", http.StatusNotFound, ErrLineNotFound.Error()},
+		{"GET", "/one", "", http.StatusBadRequest, ErrInvalidLineID.Error()},
+		{"POST", "/1/pause", "", http.StatusOK, `"state":"paused"`},
+		{"POST", "/1/resume", "", http.StatusOK, `"state":"running"`},
+		{"GET", "/1/pause", "", http.StatusMethodNotAllowed, ""},
+		{"PUT", "/1/rate", `{"rate":"2s"}`, http.StatusOK, `"rate":"2s"`},
+		{"PUT", "/1/rate", `{"rate":"-2s"}`, http.StatusBadRequest, ErrInvalidRate.Error()},
+		{"PUT", "/1/rate", `{"rate":"fast"}`, http.StatusBadRequest, ErrInvalidRate.Error()},
+		{"PUT", "/1/rate", `rate`, http.StatusBadRequest, ErrInvalidBody.Error()},
+		{"POST", "/", `{"rate":"1s"}`, http.StatusCreated, `{"id":2,"state":"running","rate":"1s","produced":0,"dropped":0}`},
+		{"POST", "/", `{"rate":"0s"}`, http.StatusBadRequest, ErrInvalidRate.Error()},
+		{"DELETE", "/2", "", http.StatusNoContent, ""},
+		{"DELETE", "/2", "", http.StatusNotFound, ErrLineNotFound.Error()},
+		{"PUT", "/", "", http.StatusMethodNotAllowed, ""},
+		{"POST", "/1/stop", "", http.StatusNotFound, ""},
+	}
+
+	// the requests run in sequence, against the same production.
+	handler := HandleProduction(newTestProduction(5 * time.Second))
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, rec.Code, tt.status)
+		}
+		if !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("%s %s: body %s, want %s", tt.method, tt.path, rec.Body, tt.want)
+		}
+		if rec.Code == http.StatusMethodNotAllowed && rec.Header().Get("Allow") == "" {
+			t.Errorf("%s %s: no Allow header", tt.method, tt.path)
+		}
+	}
+}
+
+func TestWithToken(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		token, header string
+		status        int
+	}{
+		{"secret", "Bearer secret", http.StatusNoContent},
+		{"secret", "Bearer secreT", http.StatusUnauthorized},
+		{"secret", "Bearer secret2", http.StatusUnauthorized},
+		{"secret", "secret", http.StatusUnauthorized},
+		{"secret", "", http.StatusUnauthorized},
+		{"", "Bearer ", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+
+		WithToken(tt.token, ok).ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("token %q, header %q: status %d, want %d", tt.token, tt.header, rec.Code, tt.status)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("token %q, header %q: no WWW-Authenticate header", tt.token, tt.header)
+		}
+	}
+}
+
+func TestHandleLinesState(t *testing.T) {
+	prod := newTestProduction(time.Second, time.Second)
+	prod.lines[2].Blocked = true
+	prod.lines[2].Dropped = 3
+
+	rec := httptest.NewRecorder()
+	HandleProduction(prod)(rec, httptest.NewRequest("GET", "/", nil))
+
+	var resp LinesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	got := fmt.Sprint(resp.Lines)
+	if want := "[{1 running 1s 0 0} {2 blocked 1s 0 3}]"; got != want {
+		t.Errorf("lines %s, want %s", got, want)
+	}
+}
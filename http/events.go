@@ -0,0 +1,127 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"unicorn"
+)
+
+// OrderIDQuery is the name of the query parameter which can carry the order ID
+// on streamed requests, since browsers cannot set headers on them.
+// Exported so that it can be changed by developers.
+var OrderIDQuery = "orderId"
+
+// KeepAliveInterval is the period in which a comment is sent on idle event streams,
+// so that proxies do not close the connection.
+// Exported so that it can be changed by developers.
+var KeepAliveInterval = 15 * time.Second
+
+var ErrStreamingUnsupported = errors.New("streaming is not supported")
+
+// Server-Sent Events names.
+const (
+	eventUnicorn   = "unicorn"
+	eventCompleted = "completed"
+	eventError     = "error"
+)
+
+// HandleUnicornEvents streams the order unicorns as Server-Sent Events as soon as they are ready.
+// A unicorn event is sent for each unicorn and a completed event once the order is fulfilled.
+// Streamed unicorns are collected, so they will not be returned when pooling the order.
+func HandleUnicornEvents(svc unicorn.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.NotFound(w, r)
+			return
+		}
+
+		id := getOrderID(r)
+		if id == "" {
+			id = unicorn.OrderID(r.URL.Query().Get(OrderIDQuery))
+		}
+
+		stream(w, r, svc, id)
+	}
+}
+
+// stream writes the order unicorns as Server-Sent Events until the order is fulfilled.
+func stream(w http.ResponseWriter, r *http.Request, svc unicorn.Service, id unicorn.OrderID) {
+	if _, err := svc.Status(id); err != nil {
+		raiseOrder(w, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		raise(w, ErrStreamingUnsupported, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx := r.Context()
+
+	for {
+		unicorns, pending, err := svc.Pool(id)
+		if err != nil {
+			event(w, eventError, &ErrorResponse{Error: err.Error()})
+			flusher.Flush()
+			return
+		}
+
+		for _, u := range unicorns {
+			event(w, eventUnicorn, u)
+		}
+
+		if pending == 0 {
+			event(w, eventCompleted, &UnicornsResponse{
+				Pending: pending,
+				OrderID: string(id),
+			})
+			flusher.Flush()
+			return
+		}
+
+		flusher.Flush()
+
+		if err := keepAlive(ctx, w, flusher, func(ctx context.Context) error {
+			return svc.Wait(ctx, id)
+		}); err != nil {
+			return
+		}
+	}
+}
+
+// keepAlive calls wait, sending a comment to the stream at every KeepAliveInterval until it returns.
+func keepAlive(ctx context.Context, w http.ResponseWriter, flusher http.Flusher, wait func(context.Context) error) error {
+	for {
+		wctx, cancel := context.WithTimeout(ctx, KeepAliveInterval)
+		err := wait(wctx)
+		cancel()
+
+		if err == nil || ctx.Err() != nil || !errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+
+		fmt.Fprint(w, ": keep-alive\n\n")
+		flusher.Flush()
+	}
+}
+
+// event writes a Server-Sent Event with a JSON encoded body.
+func event(w http.ResponseWriter, name string, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+}
@@ -0,0 +1,143 @@
+package http
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicorn"
+)
+
+// sse is a Server-Sent Event, or a comment if its name is empty.
+type sse struct {
+	name string
+	data string
+}
+
+// readEvent reads the next event or comment of a stream.
+func readEvent(t *testing.T, r *bufio.Reader) sse {
+	t.Helper()
+
+	var ev sse
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event stream: %v", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return ev
+		case strings.HasPrefix(line, ":"):
+			ev.data = strings.TrimSpace(line[1:])
+		case strings.HasPrefix(line, "event: "):
+			ev.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestUnicornEvents(t *testing.T) {
+	defer func(interval time.Duration) { KeepAliveInterval = interval }(KeepAliveInterval)
+	KeepAliveInterval = 10 * time.Millisecond
+
+	svc := newTestService()
+	id, _ := svc.OrderUnicorns(2)
+	svc.produce(id, 1)
+
+	srv := httptest.NewServer(HandleUnicornEvents(svc))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?" + OrderIDQuery + "=" + string(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("content type %q, want text/event-stream", ct)
+	}
+
+	r := bufio.NewReader(resp.Body)
+
+	// the unicorn ready beforehand is streamed first.
+	if ev := readEvent(t, r); ev.name != eventUnicorn || !strings.Contains(ev.data, `"`+string(id)+`-1"`) {
+		t.Errorf("got %+v, want the first unicorn", ev)
+	}
+
+	// the idle stream is kept alive.
+	if ev := readEvent(t, r); ev.name != "" || ev.data != "keep-alive" {
+		t.Errorf("got %+v, want a keep-alive comment", ev)
+	}
+
+	svc.produce(id, 1)
+
+	// skip the keep-alive comments sent in between.
+	ev := readEvent(t, r)
+	for ev.name == "" {
+		ev = readEvent(t, r)
+	}
+	if ev.name != eventUnicorn || !strings.Contains(ev.data, `"`+string(id)+`-2"`) {
+		t.Errorf("got %+v, want the second unicorn", ev)
+	}
+
+	ev = readEvent(t, r)
+	if ev.name != eventCompleted {
+		t.Fatalf("got %+v, want the completed event", ev)
+	}
+
+	var completed UnicornsResponse
+	if err := json.Unmarshal([]byte(ev.data), &completed); err != nil {
+		t.Fatal(err)
+	}
+	if completed.OrderID != string(id) || completed.Pending != 0 {
+		t.Errorf("completed %+v, want order %s with none pending", completed, id)
+	}
+
+	// the stream ends with the order.
+	if rest, _ := io.ReadAll(r); len(rest) != 0 {
+		t.Errorf("got %q after the completed event", rest)
+	}
+
+	// the streamed unicorns were collected.
+	if svc.Validate(id) {
+		t.Error("the streamed order was not fulfilled")
+	}
+}
+
+func TestUnicornEventsErrors(t *testing.T) {
+	svc := newTestService()
+	expired, _ := svc.OrderUnicorns(1)
+	svc.expire(expired)
+
+	tests := []struct {
+		method string
+		id     unicorn.OrderID
+		status int
+	}{
+		{"GET", "unknown", http.StatusNotFound},
+		{"GET", expired, http.StatusGone},
+		{"POST", expired, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/unicorns/events", nil)
+		req.Header.Set(OrderIDHeader, string(tt.id))
+
+		rec := httptest.NewRecorder()
+		HandleUnicornEvents(svc)(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s order %q: status %d, want %d", tt.method, tt.id, rec.Code, tt.status)
+		}
+	}
+}
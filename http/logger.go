@@ -48,3 +48,9 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.ResponseWriter.WriteHeader(statusCode) // write status code using original http.ResponseWriter
 	r.status = statusCode                    // capture status code
 }
+
+func (r *loggingResponseWriter) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush() // flush using original http.ResponseWriter, for streamed responses
+	}
+}
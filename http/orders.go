@@ -0,0 +1,207 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicorn"
+)
+
+var (
+	ErrMethodNotAllowed = errors.New("method not allowed")
+	ErrInvalidBody      = errors.New("invalid request body")
+)
+
+// OrderRequest is the body of an order creation request.
+type OrderRequest struct {
+	Amount   int              `json:"amount"`
+	Callback string           `json:"callback,omitempty"`
+	TTL      string           `json:"ttl,omitempty"` // duration, such as "1h30m".
+	Priority unicorn.Priority `json:"priority"`      // low, normal or high.
+
+	Capabilities unicorn.CapabilityFilter `json:"capabilities"`   // the ordered unicorns must match.
+	Spec         *unicorn.Spec            `json:"spec,omitempty"` // of custom-built unicorns.
+}
+
+// HandleOrders creates unicorn orders.
+//
+//	POST /orders
+func HandleOrders(svc unicorn.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			notAllowed(w, "POST")
+			return
+		}
+
+		var req OrderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			if errors.Is(err, unicorn.ErrInvalidPriority) {
+				raise(w, err, http.StatusBadRequest)
+				return
+			}
+			raise(w, ErrInvalidBody, http.StatusBadRequest)
+			return
+		}
+
+		if req.Amount <= 0 {
+			raise(w, ErrInvalidAmount, http.StatusBadRequest)
+			return
+		}
+
+		var options []unicorn.OrderOption
+		if req.Callback != "" {
+			options = append(options, unicorn.WithCallback(req.Callback))
+		}
+
+		if req.TTL != "" {
+			ttl, err := time.ParseDuration(req.TTL)
+			if err != nil || ttl <= 0 {
+				raise(w, ErrInvalidTTL, http.StatusBadRequest)
+				return
+			}
+			options = append(options, unicorn.WithTTL(ttl))
+		}
+
+		options = append(options, unicorn.WithPriority(req.Priority))
+
+		if err := req.Capabilities.Validate(); err != nil {
+			raise(w, err, http.StatusBadRequest)
+			return
+		}
+		options = append(options, unicorn.WithCapabilities(req.Capabilities.Required, req.Capabilities.Excluded))
+
+		if req.Spec != nil {
+			options = append(options, unicorn.WithSpec(*req.Spec))
+		}
+
+		id, err := svc.OrderUnicorns(req.Amount, options...)
+		if err != nil {
+			raiseNewOrder(w, err)
+			return
+		}
+
+		status, err := svc.Status(id)
+		if err != nil {
+			raiseOrder(w, err)
+			return
+		}
+
+		setOrderID(w, id)
+		w.Header().Set("Location", path.Join(r.URL.Path, string(id)))
+
+		reply(w, http.StatusCreated, &status)
+	}
+}
+
+// HandleOrder serves an order resource. The path must be relative to the orders resource.
+//
+//	GET    /orders/{id}
+//	DELETE /orders/{id}
+//	POST   /orders/{id}/collect
+//	GET    /orders/{id}/events
+func HandleOrder(svc unicorn.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, action, _ := strings.Cut(strings.Trim(r.URL.Path, "/"), "/")
+		if id == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch action {
+		case "":
+			switch r.Method {
+			case "GET":
+				handleOrderStatus(w, svc, unicorn.OrderID(id))
+			case "DELETE":
+				handleCancel(w, svc, unicorn.OrderID(id))
+			default:
+				notAllowed(w, "GET, DELETE")
+			}
+		case "collect":
+			if r.Method != "POST" {
+				notAllowed(w, "POST")
+				return
+			}
+			handleCollect(w, r, svc, unicorn.OrderID(id))
+		case "events":
+			if r.Method != "GET" {
+				notAllowed(w, "GET")
+				return
+			}
+			stream(w, r, svc, unicorn.OrderID(id))
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+func handleOrderStatus(w http.ResponseWriter, svc unicorn.Service, id unicorn.OrderID) {
+	status, err := svc.Status(id)
+	if err != nil {
+		raiseOrder(w, err)
+		return
+	}
+
+	reply(w, http.StatusOK, &status)
+}
+
+func handleCancel(w http.ResponseWriter, svc unicorn.Service, id unicorn.OrderID) {
+	if err := svc.CancelOrder(id); err != nil {
+		raiseOrder(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleCollect(w http.ResponseWriter, r *http.Request, svc unicorn.Service, id unicorn.OrderID) {
+	timeout, err := getWait(r)
+	if err != nil {
+		raise(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := svc.Status(id); err != nil {
+		raiseOrder(w, err)
+		return
+	}
+
+	if err := wait(r.Context(), svc, id, timeout); err != nil {
+		return // the client has gone away
+	}
+
+	unicorns, pending, err := svc.Pool(id)
+	if err != nil {
+		raiseOrder(w, err)
+		return
+	}
+
+	response := UnicornsResponse{
+		Pending:  pending,
+		OrderID:  string(id),
+		Unicorns: unicorns,
+	}
+
+	reply(w, http.StatusOK, &response)
+}
+
+// raiseOrder replies to the request with an order service error.
+func raiseOrder(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, unicorn.ErrOrderNotFound):
+		raise(w, ErrOrderIDNotFound, http.StatusNotFound)
+	case errors.Is(err, unicorn.ErrOrderExpired):
+		raise(w, ErrOrderExpired, http.StatusGone)
+	default:
+		raise(w, err, http.StatusInternalServerError)
+	}
+}
+
+// notAllowed replies to the request with a method not allowed error.
+func notAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	raise(w, ErrMethodNotAllowed, http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,161 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicorn"
+)
+
+// serve serves a request to the handler.
+func serve(handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+func TestCreateOrder(t *testing.T) {
+	svc := newTestService()
+
+	rec := serve(HandleOrders(svc), "POST", "/orders",
+		`{"amount": 2, "ttl": "1h", "priority": "high", "capabilities": {"required": ["fly"]}}`)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+
+	id := rec.Header().Get(OrderIDHeader)
+	if id == "" {
+		t.Fatal("no order ID header")
+	}
+	if loc := rec.Header().Get("Location"); loc != "/orders/"+id {
+		t.Errorf("location %q, want /orders/%s", loc, id)
+	}
+
+	var status unicorn.OrderStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if string(status.ID) != id || status.Amount != 2 || status.Priority != unicorn.PriorityHigh {
+		t.Errorf("got %+v, want order %s of 2 high priority unicorns", status, id)
+	}
+	if got := status.Capabilities.Required; len(got) != 1 || got[0] != "fly" {
+		t.Errorf("required capabilities %v, want [fly]", got)
+	}
+}
+
+func TestCreateOrderErrors(t *testing.T) {
+	tests := []struct {
+		method string
+		body   string
+		err    error // of the service when ordering
+		status int
+	}{
+		{"GET", "", nil, http.StatusMethodNotAllowed},
+		{"POST", `{"amount":`, nil, http.StatusBadRequest},
+		{"POST", `{"amount": 0}`, nil, http.StatusBadRequest},
+		{"POST", `{"amount": 1, "ttl": "forever"}`, nil, http.StatusBadRequest},
+		{"POST", `{"amount": 1, "ttl": "-1h"}`, nil, http.StatusBadRequest},
+		{"POST", `{"amount": 1, "priority": "urgent"}`, nil, http.StatusBadRequest},
+		{"POST", `{"amount": 1, "capabilities": {"required": ["fly"], "excluded": ["fly"]}}`, nil, http.StatusBadRequest},
+		{"POST", `{"amount": 1, "callback": "ftp://example.com"}`, unicorn.ErrInvalidCallback, http.StatusBadRequest},
+		{"POST", `{"amount": 1}`, unicorn.ErrInvalidFilter, http.StatusBadRequest},
+		{"POST", `{"amount": 1}`, unicorn.ErrInvalidSpec, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		svc := newTestService()
+		svc.err = tt.err
+
+		rec := serve(HandleOrders(svc), tt.method, "/orders", tt.body)
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.body, rec.Code, tt.status)
+		}
+		if tt.status == http.StatusMethodNotAllowed && rec.Header().Get("Allow") != "POST" {
+			t.Errorf("%s: allow %q, want POST", tt.method, rec.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestOrderResource(t *testing.T) {
+	svc := newTestService()
+	handler := HandleOrder(svc)
+
+	id, _ := svc.OrderUnicorns(3)
+	svc.produce(id, 1)
+
+	rec := serve(handler, "GET", "/"+string(id), "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var status unicorn.OrderStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Produced != 1 || status.Ready != 1 || status.Pending != 2 {
+		t.Errorf("status %+v, want 1 produced and ready, 2 pending", status)
+	}
+
+	rec = serve(handler, "POST", "/"+string(id)+"/collect", "")
+	if resp := decodeUnicorns(t, rec); len(resp.Unicorns) != 1 || resp.Pending != 2 {
+		t.Errorf("collect: got %+v, want 1 unicorn and 2 pending", resp)
+	}
+
+	// collecting waits for the next unicorn.
+	go svc.produce(id, 1)
+
+	rec = serve(handler, "POST", "/"+string(id)+"/collect?wait=1m", "")
+	if resp := decodeUnicorns(t, rec); len(resp.Unicorns) != 1 || resp.Pending != 1 {
+		t.Errorf("collect with wait: got %+v, want 1 unicorn and 1 pending", resp)
+	}
+
+	if rec := serve(handler, "DELETE", "/"+string(id), ""); rec.Code != http.StatusNoContent {
+		t.Errorf("cancel: status %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	// cancelled orders are gone.
+	if rec := serve(handler, "GET", "/"+string(id), ""); rec.Code != http.StatusNotFound {
+		t.Errorf("status of a cancelled order: status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestOrderResourceErrors(t *testing.T) {
+	svc := newTestService()
+	id, _ := svc.OrderUnicorns(1)
+	expired, _ := svc.OrderUnicorns(1)
+	svc.expire(expired)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{"GET", "/", http.StatusNotFound, ""},
+		{"GET", "/unknown", http.StatusNotFound, ""},
+		{"GET", "/" + string(expired), http.StatusGone, ""},
+		{"DELETE", "/unknown", http.StatusNotFound, ""},
+		{"DELETE", "/" + string(expired), http.StatusGone, ""},
+		{"POST", "/unknown/collect", http.StatusNotFound, ""},
+		{"POST", "/" + string(expired) + "/collect", http.StatusGone, ""},
+		{"POST", "/" + string(id) + "/collect?wait=soon", http.StatusBadRequest, ""},
+		{"GET", "/" + string(expired) + "/events", http.StatusGone, ""},
+		{"GET", "/" + string(id) + "/ship", http.StatusNotFound, ""},
+		{"PUT", "/" + string(id), http.StatusMethodNotAllowed, "GET, DELETE"},
+		{"GET", "/" + string(id) + "/collect", http.StatusMethodNotAllowed, "POST"},
+		{"POST", "/" + string(id) + "/events", http.StatusMethodNotAllowed, "GET"},
+	}
+
+	for _, tt := range tests {
+		rec := serve(HandleOrder(svc), tt.method, tt.path, "")
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, rec.Code, tt.status)
+		}
+		if allow := rec.Header().Get("Allow"); allow != tt.allow {
+			t.Errorf("%s %s: allow %q, want %q", tt.method, tt.path, allow, tt.allow)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicorn"
+)
+
+var (
+	ErrUnicornNotFound = errors.New("could not find the unicorn")
+	ErrInvalidLimit    = errors.New("invalid search limit")
+)
+
+// Records returned by a search when no limit is given, and the highest limit allowed.
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+)
+
+// RecordResponse is the public record of a unicorn.
+// It leaves out the order the unicorn went to, as order IDs are all it takes to poll an order.
+type RecordResponse struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Capabilities []string   `json:"capabilities"`
+	Rarity       int        `json:"rarity"`
+	ProducedAt   time.Time  `json:"producedAt"`
+	DeliveredAt  *time.Time `json:"deliveredAt,omitempty"`
+}
+
+type RecordsResponse struct {
+	Unicorns []RecordResponse `json:"unicorns"`
+}
+
+// HandleRegistry serves the records of the produced unicorns.
+// The path must be relative to the unicorns resource.
+//
+//	GET /search?name=&capability=&limit=
+//	GET /{id}
+//
+// Searches return up to defaultSearchLimit records if no limit is given.
+func HandleRegistry(reg unicorn.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := strings.Trim(r.URL.Path, "/")
+		if p == "" || strings.Contains(p, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Method != "GET" {
+			notAllowed(w, "GET")
+			return
+		}
+
+		if p == "search" {
+			handleSearch(w, r, reg)
+			return
+		}
+
+		record, err := reg.Unicorn(p)
+		if err != nil {
+			if errors.Is(err, unicorn.ErrUnicornNotFound) {
+				raise(w, ErrUnicornNotFound, http.StatusNotFound)
+				return
+			}
+			raise(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		resp := newRecordResponse(record)
+		reply(w, http.StatusOK, &resp)
+	}
+}
+
+func handleSearch(w http.ResponseWriter, r *http.Request, reg unicorn.Registry) {
+	query := unicorn.RegistryQuery{
+		Name:       r.URL.Query().Get("name"),
+		Capability: r.URL.Query().Get("capability"),
+		Limit:      defaultSearchLimit,
+	}
+
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > maxSearchLimit {
+			raise(w, ErrInvalidLimit, http.StatusBadRequest)
+			return
+		}
+		query.Limit = limit
+	}
+
+	records := reg.Search(query)
+
+	resp := RecordsResponse{
+		Unicorns: make([]RecordResponse, len(records)),
+	}
+	for i, record := range records {
+		resp.Unicorns[i] = newRecordResponse(record)
+	}
+
+	reply(w, http.StatusOK, &resp)
+}
+
+func newRecordResponse(record unicorn.Record) RecordResponse {
+	return RecordResponse{
+		ID:           record.ID,
+		Name:         record.Name,
+		Capabilities: record.Capabilities,
+		Rarity:       record.Rarity,
+		ProducedAt:   record.ProducedAt,
+		DeliveredAt:  record.DeliveredAt,
+	}
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicorn"
+	"unicorn/registry"
+)
+
+func TestRegistryHidesOrders(t *testing.T) {
+	reg := registry.New()
+	u := &unicorn.Unicorn{ID: "1", Name: "edible-celinda", Capabilities: []string{"fly"}}
+	reg.Produced(u)
+	reg.Assigned(u, "secret-order")
+
+	handler := HandleRegistry(reg)
+
+	for _, path := range []string{"/1", "/search", "/search?capability=fly"} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d, want %d", path, rec.Code, http.StatusOK)
+		}
+		if body := rec.Body.String(); strings.Contains(body, "secret-order") || strings.Contains(body, "orderId") {
+			t.Errorf("GET %s: served the order of the unicorn: %s", path, body)
+		}
+	}
+}
+
+func TestSearchLimit(t *testing.T) {
+	reg := registry.New()
+	for i := 0; i < defaultSearchLimit+10; i++ {
+		reg.Produced(&unicorn.Unicorn{ID: fmt.Sprint(i), Name: "edible-celinda"})
+	}
+
+	handler := HandleRegistry(reg)
+
+	tests := []struct {
+		query  string
+		status int
+		found  int
+	}{
+		{"", http.StatusOK, defaultSearchLimit},
+		{"?limit=5", http.StatusOK, 5},
+		{"?name=edible-celinda&limit=1000", http.StatusOK, defaultSearchLimit + 10},
+		{"?limit=0", http.StatusBadRequest, 0},
+		{"?limit=1001", http.StatusBadRequest, 0},
+		{"?limit=many", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/search"+tt.query, nil))
+
+		if rec.Code != tt.status {
+			t.Errorf("search %q: status %d, want %d", tt.query, rec.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+
+		var resp RecordsResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Unicorns) != tt.found {
+			t.Errorf("search %q: found %d, want %d", tt.query, len(resp.Unicorns), tt.found)
+		}
+	}
+}
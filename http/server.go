@@ -1,11 +1,14 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 	"unicorn"
 )
 
@@ -13,10 +16,17 @@ import (
 // Exported so that it can be changed by developers.
 var OrderIDHeader = "X-Unicorn-Order-Id"
 
+// MaxWait is the longest a request can wait for unicorns to be ready.
+// Exported so that it can be changed by developers.
+var MaxWait = time.Minute
+
 var (
 	ErrNoAmount        = errors.New("no unicorn amount provided for the order")
 	ErrInvalidAmount   = errors.New("invalid amount of unicorns")
+	ErrInvalidWait     = errors.New("invalid wait duration")
 	ErrOrderIDNotFound = errors.New("could not find your order")
+	ErrOrderExpired    = errors.New("your order has expired")
+	ErrInvalidTTL      = errors.New("invalid order ttl")
 )
 
 type ErrorResponse struct {
@@ -42,14 +52,24 @@ func HandleGetUnicorns(svc unicorn.Service) http.HandlerFunc {
 			return
 		}
 
-		if !svc.Validate(id) {
-			raise(w, ErrOrderIDNotFound, http.StatusNotFound)
+		if _, err := svc.Status(id); err != nil {
+			raiseOrder(w, err)
 			return
 		}
 
+		timeout, err := getWait(r)
+		if err != nil {
+			raise(w, err, http.StatusBadRequest)
+			return
+		}
+
+		if err := wait(r.Context(), svc, id, timeout); err != nil {
+			return // the client has gone away
+		}
+
 		unicorns, pending, err := svc.Pool(id)
 		if err != nil {
-			raise(w, err, http.StatusInternalServerError)
+			raiseOrder(w, err)
 			return
 		}
 
@@ -71,17 +91,64 @@ func handleNewOrder(svc unicorn.Service) http.HandlerFunc {
 			return
 		}
 
-		id, err := svc.OrderUnicorns(amount)
+		timeout, err := getWait(r)
+		if err != nil {
+			raise(w, err, http.StatusBadRequest)
+			return
+		}
+
+		var options []unicorn.OrderOption
+
+		if callback := r.URL.Query().Get("callback"); callback != "" {
+			options = append(options, unicorn.WithCallback(callback))
+		}
+
+		ttl, err := getTTL(r)
+		if err != nil {
+			raise(w, err, http.StatusBadRequest)
+			return
+		}
+		if ttl != 0 {
+			options = append(options, unicorn.WithTTL(ttl))
+		}
+
+		if s := r.URL.Query().Get("priority"); s != "" {
+			priority, err := unicorn.ParsePriority(s)
+			if err != nil {
+				raise(w, err, http.StatusBadRequest)
+				return
+			}
+			options = append(options, unicorn.WithPriority(priority))
+		}
+
+		filter := getCapabilities(r)
+		if err := filter.Validate(); err != nil {
+			raise(w, err, http.StatusBadRequest)
+			return
+		}
+		if !filter.Empty() {
+			options = append(options, unicorn.WithCapabilities(filter.Required, filter.Excluded))
+		}
+
+		if spec := getSpec(r); spec != nil {
+			options = append(options, unicorn.WithSpec(*spec))
+		}
+
+		id, err := svc.OrderUnicorns(amount, options...)
 		if err != nil {
-			raise(w, fmt.Errorf("could not order unicorns: %w", err), http.StatusServiceUnavailable)
+			raiseNewOrder(w, err)
 			return
 		}
 
 		setOrderID(w, id)
 
+		if err := wait(r.Context(), svc, id, timeout); err != nil {
+			return // the client has gone away
+		}
+
 		unicorns, pending, err := svc.Pool(id)
 		if err != nil {
-			raise(w, err, http.StatusInternalServerError)
+			raiseOrder(w, err)
 			return
 		}
 
@@ -109,6 +176,90 @@ func getAmount(r *http.Request) (int, error) {
 	return amount, nil
 }
 
+// getCapabilities retrieves the optional capability filter from the query,
+// with comma separated required and excluded capabilities.
+func getCapabilities(r *http.Request) unicorn.CapabilityFilter {
+	return unicorn.CapabilityFilter{
+		Required: splitList(r.URL.Query().Get("require")),
+		Excluded: splitList(r.URL.Query().Get("exclude")),
+	}
+}
+
+// getSpec retrieves the optional spec of custom-built unicorns from the query,
+// with the comma separated capabilities to build and a name prefix.
+func getSpec(r *http.Request) *unicorn.Spec {
+	capabilities := splitList(r.URL.Query().Get("build"))
+	if len(capabilities) == 0 {
+		return nil
+	}
+
+	return &unicorn.Spec{
+		Capabilities: capabilities,
+		NamePrefix:   r.URL.Query().Get("prefix"),
+	}
+}
+
+// splitList splits a comma separated list, ignoring empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getTTL retrieves the optional order TTL from the query.
+func getTTL(r *http.Request) (time.Duration, error) {
+	s := r.URL.Query().Get("ttl")
+	if s == "" {
+		return 0, nil
+	}
+
+	ttl, err := time.ParseDuration(s)
+	if err != nil || ttl <= 0 {
+		return 0, ErrInvalidTTL
+	}
+
+	return ttl, nil
+}
+
+// getWait retrieves the optional duration to wait for unicorns from the query.
+// It is capped to MaxWait.
+func getWait(r *http.Request) (time.Duration, error) {
+	s := r.URL.Query().Get("wait")
+	if s == "" {
+		return 0, nil
+	}
+
+	wait, err := time.ParseDuration(s)
+	if err != nil || wait < 0 {
+		return 0, ErrInvalidWait
+	}
+
+	if wait > MaxWait {
+		wait = MaxWait
+	}
+
+	return wait, nil
+}
+
+// wait blocks until the order has unicorns ready to be collected, its production
+// has completed or the timeout expires. It only fails if ctx is done.
+func wait(ctx context.Context, svc unicorn.Service, id unicorn.OrderID, timeout time.Duration) error {
+	if timeout == 0 {
+		return nil
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	svc.Wait(wctx, id)
+
+	return ctx.Err()
+}
+
 // setOrderID writes the order ID to the responde headers.
 func setOrderID(w http.ResponseWriter, id unicorn.OrderID) {
 	if id == "" {
@@ -139,6 +290,18 @@ func reply(w http.ResponseWriter, code int, body any) {
 	json.NewEncoder(w).Encode(body)
 }
 
+// raiseNewOrder replies to the request with an order creation error.
+func raiseNewOrder(w http.ResponseWriter, err error) {
+	err = fmt.Errorf("could not order unicorns: %w", err)
+
+	switch {
+	case errors.Is(err, unicorn.ErrInvalidSpec), errors.Is(err, unicorn.ErrInvalidFilter), errors.Is(err, unicorn.ErrInvalidCallback):
+		raise(w, err, http.StatusBadRequest)
+	default:
+		raise(w, err, http.StatusServiceUnavailable)
+	}
+}
+
 // raise replies to the request with the service error message and HTTP code.
 // It does not otherwise end the request; the caller should ensure no further
 // writes are done to w.
@@ -0,0 +1,352 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"unicorn"
+)
+
+// testService is an in-memory unicorn service, producing unicorns on demand.
+type testService struct {
+	mu      sync.Mutex
+	orders  map[unicorn.OrderID]*testOrder
+	expired map[unicorn.OrderID]bool
+	nextID  int
+	err     error         // returned when ordering, if set.
+	changed chan struct{} // closed and replaced whenever unicorns are produced.
+}
+
+type testOrder struct {
+	options   unicorn.OrderOptions
+	amount    int
+	produced  int
+	delivered int
+	ready     []*unicorn.Unicorn
+}
+
+func newTestService() *testService {
+	return &testService{
+		orders:  make(map[unicorn.OrderID]*testOrder),
+		expired: make(map[unicorn.OrderID]bool),
+		changed: make(chan struct{}),
+	}
+}
+
+// produce adds n unicorns to an order.
+func (s *testService) produce(id unicorn.OrderID, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o := s.orders[id]
+	for i := 0; i < n; i++ {
+		o.produced++
+		o.ready = append(o.ready, &unicorn.Unicorn{ID: fmt.Sprintf("%s-%d", id, o.produced), Name: "edible-celinda"})
+	}
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// expire forgets an order, as expired.
+func (s *testService) expire(id unicorn.OrderID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.orders, id)
+	s.expired[id] = true
+}
+
+func (s *testService) OrderUnicorns(amount int, options ...unicorn.OrderOption) (unicorn.OrderID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return "", s.err
+	}
+
+	var opts unicorn.OrderOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	s.nextID++
+	id := unicorn.OrderID(fmt.Sprintf("order%d", s.nextID))
+	s.orders[id] = &testOrder{options: opts, amount: amount}
+
+	return id, nil
+}
+
+func (s *testService) Pool(id unicorn.OrderID) ([]*unicorn.Unicorn, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, err := s.lookup(id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	unicorns := o.ready
+	o.ready = nil
+	o.delivered += len(unicorns)
+
+	if o.delivered == o.amount {
+		delete(s.orders, id)
+	}
+
+	return unicorns, o.amount - o.produced, nil
+}
+
+func (s *testService) CancelOrder(id unicorn.OrderID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.lookup(id); err != nil {
+		return err
+	}
+
+	delete(s.orders, id)
+	return nil
+}
+
+func (s *testService) Status(id unicorn.OrderID) (unicorn.OrderStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, err := s.lookup(id)
+	if err != nil {
+		return unicorn.OrderStatus{}, err
+	}
+
+	return unicorn.OrderStatus{
+		ID:           id,
+		Priority:     o.options.Priority,
+		Amount:       o.amount,
+		Produced:     o.produced,
+		Ready:        len(o.ready),
+		Delivered:    o.delivered,
+		Pending:      o.amount - o.produced,
+		Capabilities: o.options.Capabilities,
+	}, nil
+}
+
+func (s *testService) Wait(ctx context.Context, id unicorn.OrderID) error {
+	for {
+		s.mu.Lock()
+		o, err := s.lookup(id)
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		done := len(o.ready) > 0 || o.produced == o.amount
+		changed := s.changed
+		s.mu.Unlock()
+
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (s *testService) Validate(id unicorn.OrderID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.orders[id]
+	return ok
+}
+
+// lookup returns an order. Must be called with the lock held.
+func (s *testService) lookup(id unicorn.OrderID) (*testOrder, error) {
+	if o, ok := s.orders[id]; ok {
+		return o, nil
+	}
+	if s.expired[id] {
+		return nil, unicorn.ErrOrderExpired
+	}
+	return nil, unicorn.ErrOrderNotFound
+}
+
+// get serves a GET request to the handler, with the order ID header if set.
+func get(handler http.HandlerFunc, target string, id unicorn.OrderID) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	if id != "" {
+		req.Header.Set(OrderIDHeader, string(id))
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func decodeUnicorns(t *testing.T, rec *httptest.ResponseRecorder) UnicornsResponse {
+	t.Helper()
+
+	var resp UnicornsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	return resp
+}
+
+func TestGetUnicorns(t *testing.T) {
+	svc := newTestService()
+	handler := HandleGetUnicorns(svc)
+
+	rec := get(handler, "/unicorns?amount=2", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ordering: status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	id := unicorn.OrderID(rec.Header().Get(OrderIDHeader))
+	if resp := decodeUnicorns(t, rec); resp.OrderID != string(id) || resp.Pending != 2 {
+		t.Errorf("ordering: got %+v, want order %s with 2 pending", resp, id)
+	}
+
+	svc.produce(id, 2)
+
+	rec = get(handler, "/unicorns", id)
+	if resp := decodeUnicorns(t, rec); len(resp.Unicorns) != 2 || resp.Pending != 0 {
+		t.Errorf("pooling: got %+v, want 2 unicorns and none pending", resp)
+	}
+
+	// fulfilled orders are forgotten.
+	if rec := get(handler, "/unicorns", id); rec.Code != http.StatusNotFound {
+		t.Errorf("pooling a fulfilled order: status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestGetUnicornsErrors(t *testing.T) {
+	svc := newTestService()
+	expired, _ := svc.OrderUnicorns(1)
+	svc.expire(expired)
+
+	tests := []struct {
+		target string
+		id     unicorn.OrderID
+		err    error // of the service when ordering
+		status int
+	}{
+		{"/unicorns", "", nil, http.StatusBadRequest},
+		{"/unicorns?amount=0", "", nil, http.StatusBadRequest},
+		{"/unicorns?amount=many", "", nil, http.StatusBadRequest},
+		{"/unicorns?amount=1&ttl=-1s", "", nil, http.StatusBadRequest},
+		{"/unicorns?amount=1&priority=urgent", "", nil, http.StatusBadRequest},
+		{"/unicorns?amount=1&require=fly&exclude=fly", "", nil, http.StatusBadRequest},
+		{"/unicorns?amount=1&wait=soon", "", nil, http.StatusBadRequest},
+		{"/unicorns?amount=1&require=teleport", "", unicorn.ErrInvalidFilter, http.StatusBadRequest},
+		{"/unicorns?amount=1&callback=ftp://example.com", "", unicorn.ErrInvalidCallback, http.StatusBadRequest},
+		{"/unicorns?amount=1&build=fly", "", unicorn.ErrInvalidSpec, http.StatusBadRequest},
+		{"/unicorns?amount=1", "", fmt.Errorf("out of horns"), http.StatusServiceUnavailable},
+		{"/unicorns", "unknown", nil, http.StatusNotFound},
+		{"/unicorns", expired, nil, http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		svc.err = tt.err
+
+		if rec := get(HandleGetUnicorns(svc), tt.target, tt.id); rec.Code != tt.status {
+			t.Errorf("GET %s (order %q): status %d, want %d", tt.target, tt.id, rec.Code, tt.status)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	HandleGetUnicorns(svc)(rec, httptest.NewRequest("POST", "/unicorns?amount=1", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("POST: status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestLongPolling(t *testing.T) {
+	svc := newTestService()
+	handler := HandleGetUnicorns(svc)
+
+	id, _ := svc.OrderUnicorns(2)
+
+	// the unicorn produced while waiting is replied right away.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		svc.produce(id, 1)
+	}()
+
+	start := time.Now()
+	rec := get(handler, "/unicorns?wait=1m", id)
+
+	if elapsed := time.Since(start); elapsed > 30*time.Second {
+		t.Errorf("replied after %v", elapsed)
+	}
+	if resp := decodeUnicorns(t, rec); len(resp.Unicorns) != 1 || resp.Pending != 1 {
+		t.Errorf("got %+v, want 1 unicorn and 1 pending", resp)
+	}
+
+	// the wait expires without unicorns.
+	rec = get(handler, "/unicorns?wait=10ms", id)
+	if resp := decodeUnicorns(t, rec); len(resp.Unicorns) != 0 || resp.Pending != 1 {
+		t.Errorf("got %+v, want no unicorn and 1 pending", resp)
+	}
+
+	// a new order waits for its first unicorns too.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		svc.produce("order2", 1)
+	}()
+
+	rec = get(handler, "/unicorns?amount=1&wait=1m", "")
+	if resp := decodeUnicorns(t, rec); resp.OrderID != "order2" || len(resp.Unicorns) != 1 || resp.Pending != 0 {
+		t.Errorf("got %+v, want the unicorn of order2", resp)
+	}
+}
+
+func TestLongPollingClientGone(t *testing.T) {
+	svc := newTestService()
+	id, _ := svc.OrderUnicorns(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := httptest.NewRequest("GET", "/unicorns?wait=1m", nil).WithContext(ctx)
+	req.Header.Set(OrderIDHeader, string(id))
+
+	rec := httptest.NewRecorder()
+	HandleGetUnicorns(svc)(rec, req)
+
+	// nothing is collected for a client that has gone away.
+	if status, _ := svc.Status(id); status.Delivered != 0 || rec.Body.Len() != 0 {
+		t.Errorf("replied %q to a client gone away", rec.Body)
+	}
+}
+
+func TestGetWait(t *testing.T) {
+	defer func(max time.Duration) { MaxWait = max }(MaxWait)
+	MaxWait = time.Minute
+
+	tests := []struct {
+		query string
+		want  time.Duration
+		err   error
+	}{
+		{"", 0, nil},
+		{"?wait=5s", 5 * time.Second, nil},
+		{"?wait=1h", time.Minute, nil},
+		{"?wait=-1s", 0, ErrInvalidWait},
+		{"?wait=soon", 0, ErrInvalidWait},
+	}
+
+	for _, tt := range tests {
+		got, err := getWait(httptest.NewRequest("GET", "/unicorns"+tt.query, nil))
+		if got != tt.want || err != tt.err {
+			t.Errorf("getWait(%q) = %v, %v, want %v, %v", tt.query, got, err, tt.want, tt.err)
+		}
+	}
+}
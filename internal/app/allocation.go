@@ -0,0 +1,70 @@
+package app
+
+// Allocation is a strategy to allocate the production among the orders being fulfilled.
+type Allocation interface {
+	// width returns how many orders can be fulfilled at the same time.
+	width() int
+
+	// next returns the index of the active order to receive the next unicorn.
+	// active orders are in the order they left the logistics queue, and are never empty.
+	next(active []*order) int
+}
+
+type fifo struct{}
+
+// FIFO fulfills one order at a time, in the order they leave the logistics queue.
+func FIFO() Allocation {
+	return fifo{}
+}
+
+func (fifo) width() int               { return 1 }
+func (fifo) next(active []*order) int { return 0 }
+
+type roundRobin struct {
+	n    int
+	turn int
+}
+
+// RoundRobin fulfills up to n orders at a time, giving one unicorn to each in turn.
+func RoundRobin(n int) Allocation {
+	if n < 1 {
+		n = 1
+	}
+
+	return &roundRobin{n: n}
+}
+
+func (rr *roundRobin) width() int { return rr.n }
+
+func (rr *roundRobin) next(active []*order) int {
+	i := rr.turn % len(active)
+	rr.turn = i + 1
+	return i
+}
+
+type proportional struct {
+	n int
+}
+
+// Proportional fulfills up to n orders at a time, splitting the production in proportion
+// to their amounts, so that they progress at the same pace.
+func Proportional(n int) Allocation {
+	if n < 1 {
+		n = 1
+	}
+
+	return proportional{n: n}
+}
+
+func (p proportional) width() int { return p.n }
+
+// next selects the order with the least progress. Ties go to the first order.
+func (p proportional) next(active []*order) int {
+	selected := 0
+	for i := 1; i < len(active); i++ {
+		if active[i].progress() < active[selected].progress() {
+			selected = i
+		}
+	}
+	return selected
+}
@@ -0,0 +1,177 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+	"unicorn"
+)
+
+// Rates are only changed if they differ more than this fraction,
+// since changing a rate restarts the production of the next unicorn.
+const rateTolerance = 0.1
+
+// AutoscalerConfig configures the production autoscaling.
+type AutoscalerConfig struct {
+	MinRate time.Duration // fastest production rate of a line.
+	MaxRate time.Duration // slowest production rate of a line.
+
+	// Horizon is the time in which the lines should produce the pending orders backlog.
+	Horizon time.Duration
+
+	// TargetStock is the number of unicorns in storage above which the production pauses,
+	// while no orders are pending.
+	TargetStock int
+}
+
+type autoscaler struct {
+	plant     *plant
+	logistics *logisticsCenter
+	config    AutoscalerConfig
+
+	mu     sync.Mutex
+	paused map[int]struct{}      // lines paused by the autoscaler
+	rates  map[int]time.Duration // last rate of the lines known to the autoscaler
+	manual map[int]struct{}      // lines whose rate was set by someone else. no longer scaled.
+}
+
+// NewAutoscaler creates an autoscaler, which adjusts the rate of the plant production lines
+// to the pending orders backlog and the unicorns in stock.
+func NewAutoscaler(plant *plant, logistics *logisticsCenter, config AutoscalerConfig) (*autoscaler, error) {
+	if config.MinRate <= 0 || config.MaxRate < config.MinRate || config.Horizon <= 0 {
+		return nil, unicorn.ErrInvalidRate
+	}
+
+	a := &autoscaler{
+		plant:     plant,
+		logistics: logistics,
+		config:    config,
+		paused:    make(map[int]struct{}),
+		rates:     make(map[int]time.Duration),
+		manual:    make(map[int]struct{}),
+	}
+
+	// the initial rates are taken over, any later change is manual.
+	for _, line := range plant.Lines() {
+		a.rates[line.ID] = line.Rate
+	}
+
+	return a, nil
+}
+
+// StartAutoscaling adjusts the production at every interval, until ctx is done.
+func (a *autoscaler) StartAutoscaling(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.Scale()
+		}
+	}
+}
+
+// Scale adjusts the production lines to the current backlog and stock.
+//
+// While orders are pending, the lines speed up so that the backlog is produced within the horizon.
+// Otherwise, the lines produce at the slowest rate until the target stock is reached, and then pause.
+// Lines paused by other means are left alone, as well as lines whose rate was set by other means,
+// such as the admin API.
+func (a *autoscaler) Scale() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	lines := a.managed(a.plant.Lines())
+	if len(lines) == 0 {
+		return
+	}
+
+	// forget the lines resumed by someone else, and count the ones that can produce.
+	producing := 0
+	for _, line := range lines {
+		if !line.Paused {
+			delete(a.paused, line.ID)
+		}
+		if _, ok := a.paused[line.ID]; ok || !line.Paused {
+			producing++
+		}
+	}
+	if producing == 0 {
+		return
+	}
+
+	backlog := a.logistics.PendingProduction()
+	stock := a.logistics.InStorage()
+
+	if backlog == 0 && stock >= a.config.TargetStock {
+		for _, line := range lines {
+			if line.Paused {
+				continue
+			}
+			if a.plant.Pause(line.ID) == nil {
+				a.paused[line.ID] = struct{}{}
+			}
+		}
+		return
+	}
+
+	rate := a.config.MaxRate
+	if backlog > 0 {
+		// each producing line makes its share of the backlog within the horizon.
+		rate = a.config.Horizon * time.Duration(producing) / time.Duration(backlog)
+	}
+
+	if rate < a.config.MinRate {
+		rate = a.config.MinRate
+	}
+	if rate > a.config.MaxRate {
+		rate = a.config.MaxRate
+	}
+
+	for _, line := range lines {
+		if line.Paused {
+			if _, ok := a.paused[line.ID]; !ok {
+				continue // paused by someone else.
+			}
+		}
+
+		if !withinTolerance(line.Rate, rate) && a.plant.SetRate(line.ID, rate) == nil {
+			a.rates[line.ID] = rate
+		}
+
+		if line.Paused && a.plant.Resume(line.ID) == nil {
+			delete(a.paused, line.ID)
+		}
+	}
+}
+
+// managed returns the lines scaled by the autoscaler, leaving out the ones
+// whose rate was set by someone else since the autoscaler last did.
+func (a *autoscaler) managed(lines []unicorn.LineStats) []unicorn.LineStats {
+	managed := lines[:0]
+	for _, line := range lines {
+		if rate, ok := a.rates[line.ID]; ok && rate != line.Rate {
+			a.manual[line.ID] = struct{}{}
+		}
+		if _, ok := a.manual[line.ID]; ok {
+			continue
+		}
+
+		a.rates[line.ID] = line.Rate
+		managed = append(managed, line)
+	}
+	return managed
+}
+
+// withinTolerance reports whether rate is close enough to the target rate.
+func withinTolerance(rate, target time.Duration) bool {
+	diff := rate - target
+	if diff < 0 {
+		diff = -diff
+	}
+
+	return float64(diff) <= float64(target)*rateTolerance
+}
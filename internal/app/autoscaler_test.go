@@ -0,0 +1,158 @@
+package app
+
+import (
+	"testing"
+	"time"
+	"unicorn"
+	"unicorn/storage/lifo"
+)
+
+// testFactory produces unicorns without capabilities.
+type testFactory struct{}
+
+func (testFactory) NewUnicorn() *unicorn.Unicorn {
+	return &unicorn.Unicorn{Name: "spirit", CreatedAt: time.Now()}
+}
+
+// newTestPlant creates a plant, not running, with a line at each rate.
+func newTestPlant(t *testing.T, lc *logisticsCenter, rates ...time.Duration) *plant {
+	t.Helper()
+
+	p := NewPlant(lc, testFactory{})
+	for _, rate := range rates {
+		if _, err := p.NewLine(rate); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+// lineStates describes the lines of a plant, such as "1s" or "paused 10s".
+func lineStates(p *plant) []string {
+	var states []string
+	for _, line := range p.Lines() {
+		state := line.Rate.String()
+		if line.Paused {
+			state = "paused " + state
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+func equalStates(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAutoscaler(t *testing.T) {
+	store := lifo.New()
+	lc := NewLogisticsCenter(store)
+	p := newTestPlant(t, lc, 5*time.Second, 5*time.Second)
+
+	a, err := NewAutoscaler(p, lc, AutoscalerConfig{
+		MinRate:     time.Second,
+		MaxRate:     10 * time.Second,
+		Horizon:     10 * time.Second,
+		TargetStock: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backlog := newTestOrder("backlog", 10)
+
+	steps := []struct {
+		name   string
+		change func()
+		want   []string
+	}{
+		{"no backlog nor stock", func() {}, []string{"10s", "10s"}},
+		{"backlog", func() { lc.AddOrder(backlog) }, []string{"2s", "2s"}},
+		{"bigger backlog than the fastest rate", func() { lc.AddOrder(newTestOrder("big", 100)) }, []string{"1s", "1s"}},
+		{"stock reached", func() {
+			lc.CancelOrder(backlog)
+			for _, o := range lc.PendingOrders() {
+				lc.CancelOrder(o)
+			}
+			for i := 0; i < 2; i++ {
+				store.Store(&unicorn.Unicorn{})
+			}
+		}, []string{"paused 1s", "paused 1s"}},
+		{"backlog again", func() { lc.AddOrder(newTestOrder("again", 20)) }, []string{"1s", "1s"}},
+	}
+
+	for _, step := range steps {
+		step.change()
+		a.Scale()
+
+		if got := lineStates(p); !equalStates(got, step.want) {
+			t.Errorf("%s: lines %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestAutoscalerLeavesManualLines(t *testing.T) {
+	lc := NewLogisticsCenter(lifo.New())
+	p := newTestPlant(t, lc, 5*time.Second, 5*time.Second, 5*time.Second)
+
+	a, err := NewAutoscaler(p, lc, AutoscalerConfig{
+		MinRate:     time.Second,
+		MaxRate:     10 * time.Second,
+		Horizon:     10 * time.Second,
+		TargetStock: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.Scale()
+
+	// set through the admin API, between two scalings.
+	if err := p.SetRate(1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Pause(2); err != nil {
+		t.Fatal(err)
+	}
+
+	lc.AddOrder(newTestOrder("backlog", 10))
+	a.Scale()
+
+	// the backlog is shared by the line left to the autoscaler.
+	if got, want := lineStates(p), []string{"3s", "paused 10s", "1s"}; !equalStates(got, want) {
+		t.Errorf("lines %v, want %v", got, want)
+	}
+
+	// the manual rate sticks, even once the backlog is gone.
+	for _, o := range lc.PendingOrders() {
+		lc.CancelOrder(o)
+	}
+	a.Scale()
+
+	if got, want := lineStates(p), []string{"3s", "paused 10s", "10s"}; !equalStates(got, want) {
+		t.Errorf("lines %v, want %v", got, want)
+	}
+}
+
+func TestNewAutoscalerConfig(t *testing.T) {
+	lc := NewLogisticsCenter(lifo.New())
+	p := newTestPlant(t, lc)
+
+	for _, config := range []AutoscalerConfig{
+		{MinRate: 0, MaxRate: time.Second, Horizon: time.Second},
+		{MinRate: 2 * time.Second, MaxRate: time.Second, Horizon: time.Second},
+		{MinRate: time.Second, MaxRate: time.Second, Horizon: 0},
+	} {
+		if _, err := NewAutoscaler(p, lc, config); err != unicorn.ErrInvalidRate {
+			t.Errorf("NewAutoscaler(%+v) = %v, want %v", config, err, unicorn.ErrInvalidRate)
+		}
+	}
+}
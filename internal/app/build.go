@@ -0,0 +1,158 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+	"unicorn"
+	"unicorn/factory"
+	"unicorn/pkg/pqueue"
+)
+
+// buildLine custom-builds unicorns to the spec of the orders, one order at a time.
+// Custom-built orders bypass the storage and the regular production.
+type buildLine struct {
+	builder  factory.Builder
+	logistic *logisticsCenter
+
+	mu    sync.Mutex
+	rate  time.Duration                 // period in which a unicorn is built
+	queue *pqueue.PriorityQueue[*order] // queue of orders to build, by priority
+	built int                           // unicorns built by the line
+
+	completed func(*order)  // called when the production of an order has completed
+	added     chan struct{} // signals a new order
+}
+
+// NewBuildLine creates a new build line, building a unicorn at every rate.
+// Unicorns left by cancelled orders are handed to the logistics center.
+func NewBuildLine(builder factory.Builder, logistics *logisticsCenter, rate time.Duration) (*buildLine, error) {
+	if rate <= 0 {
+		return nil, unicorn.ErrInvalidRate
+	}
+
+	return &buildLine{
+		builder:  builder,
+		logistic: logistics,
+		rate:     rate,
+		queue:    pqueue.New(func(a, b *order) bool { return a.priority > b.priority }),
+		added:    make(chan struct{}, 1),
+	}, nil
+}
+
+// OnCompleted sets a function to be called when the production of an order has completed.
+// It is called with the build line locked, so it must not block.
+func (bl *buildLine) OnCompleted(fn func(*order)) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	bl.completed = fn
+}
+
+// Validate checks that unicorns can be built to the spec.
+func (bl *buildLine) Validate(spec unicorn.Spec) error {
+	return bl.builder.Validate(spec)
+}
+
+// AddOrder queues a custom-built order.
+func (bl *buildLine) AddOrder(order *order) {
+	bl.mu.Lock()
+	bl.queue.Push(order)
+	bl.mu.Unlock()
+
+	select {
+	case bl.added <- struct{}{}:
+	default:
+	}
+}
+
+// CancelOrder removes an order from the build queue.
+// Its built unicorns that were not collected are given back to the logistics center,
+// as new production. It returns the number of them that were discarded for not fitting in storage.
+func (bl *buildLine) CancelOrder(cancelled *order) int {
+	bl.mu.Lock()
+	unicorns := cancelled.Cancel()
+	bl.queue.RemoveFunc(func(o *order) bool { return o == cancelled })
+	bl.mu.Unlock()
+
+	return bl.logistic.GiveBack(unicorns)
+}
+
+// PendingOrders returns the orders waiting to be built, in the order they will be built.
+func (bl *buildLine) PendingOrders() []*order {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	return bl.queue.Items()
+}
+
+// Built returns the number of unicorns built by the line.
+func (bl *buildLine) Built() int {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	return bl.built
+}
+
+// StartProduction starts building unicorns for the queued orders until ctx is done.
+func (bl *buildLine) StartProduction(ctx context.Context) {
+	timer := time.NewTimer(bl.rate)
+	defer timer.Stop()
+
+	for {
+		bl.mu.Lock()
+		idle := bl.queue.Empty()
+		bl.mu.Unlock()
+
+		if idle {
+			select {
+			case <-ctx.Done():
+				return
+			case <-bl.added:
+				continue
+			}
+		}
+
+		stopTimer(timer)
+		timer.Reset(bl.rate)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			bl.build()
+		}
+	}
+}
+
+// build a unicorn for the first queued order.
+func (bl *buildLine) build() {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	order, ok := bl.queue.Peek()
+	if !ok {
+		return // cancelled while building
+	}
+
+	u, err := bl.builder.Build(*order.spec)
+	if err != nil {
+		// specs are validated when ordering, so only a changed builder gets here.
+		bl.queue.Pop()
+		bl.logistic.GiveBack(order.Cancel())
+		return
+	}
+	bl.built++
+	bl.logistic.recorder.Produced(u)
+
+	if order.Add(u) {
+		bl.logistic.recorder.Assigned(u, order.ID)
+	}
+
+	if order.ProductionHasCompleted() {
+		bl.queue.Pop()
+		if bl.completed != nil {
+			bl.completed(order)
+		}
+	}
+}
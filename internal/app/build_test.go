@@ -0,0 +1,157 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+	"unicorn"
+	"unicorn/storage/lifo"
+)
+
+// testBuilder builds unicorns with exactly the capabilities of the spec.
+type testBuilder struct {
+	built int
+	err   error // returned by every build, if set.
+}
+
+func (b *testBuilder) Validate(spec unicorn.Spec) error {
+	if len(spec.Capabilities) == 0 {
+		return unicorn.ErrInvalidSpec
+	}
+	return nil
+}
+
+func (b *testBuilder) Build(spec unicorn.Spec) (*unicorn.Unicorn, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	b.built++
+	return &unicorn.Unicorn{ID: fmt.Sprint(b.built), Name: spec.NamePrefix, Capabilities: spec.Capabilities}, nil
+}
+
+func newBuildOrder(id string, amount uint, priority unicorn.Priority) *order {
+	o := NewOrder(unicorn.OrderID(id), amount)
+	o.priority = priority
+	o.spec = &unicorn.Spec{Capabilities: []string{"fly"}, NamePrefix: id}
+	return o
+}
+
+func TestBuildLine(t *testing.T) {
+	var completed []unicorn.OrderID
+
+	bl, err := NewBuildLine(&testBuilder{}, NewLogisticsCenter(lifo.New()), time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bl.OnCompleted(func(o *order) { completed = append(completed, o.ID) })
+
+	normal := newBuildOrder("normal", 1, unicorn.PriorityNormal)
+	high := newBuildOrder("high", 2, unicorn.PriorityHigh)
+	bl.AddOrder(normal)
+	bl.AddOrder(high)
+
+	for i := 0; i < 3; i++ {
+		bl.build()
+	}
+
+	if len(completed) != 2 || completed[0] != high.ID || completed[1] != normal.ID {
+		t.Errorf("completed %v, want [high normal]", completed)
+	}
+	if n := bl.Built(); n != 3 {
+		t.Errorf("built %d unicorns, want 3", n)
+	}
+
+	for _, u := range high.Collect() {
+		if u.Name != "high" || !u.Has("fly") {
+			t.Errorf("unicorn %+v not built to the spec", u)
+		}
+	}
+
+	// nothing left to build.
+	bl.build()
+	if n := bl.Built(); n != 3 {
+		t.Errorf("built %d unicorns without orders, want 3", n)
+	}
+}
+
+func TestBuildLineCancel(t *testing.T) {
+	store := lifo.New()
+	bl, err := NewBuildLine(&testBuilder{}, NewLogisticsCenter(store), time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := newBuildOrder("order", 3, unicorn.PriorityNormal)
+	bl.AddOrder(o)
+	bl.build()
+	bl.build()
+
+	// the built unicorns go to stock, and no more are built.
+	if dropped := bl.CancelOrder(o); dropped != 0 {
+		t.Errorf("dropped %d unicorns, want 0", dropped)
+	}
+	if n := store.InStorage(); n != 2 {
+		t.Errorf("%d unicorns in storage, want 2", n)
+	}
+	if pending := bl.PendingOrders(); len(pending) != 0 {
+		t.Errorf("%d orders pending, want 0", len(pending))
+	}
+}
+
+func TestBuildLineError(t *testing.T) {
+	builder := &testBuilder{}
+	store := lifo.New()
+	bl, err := NewBuildLine(builder, NewLogisticsCenter(store), time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := newBuildOrder("order", 2, unicorn.PriorityNormal)
+	bl.AddOrder(o)
+	bl.build()
+
+	builder.err = errors.New("out of horns")
+	bl.build()
+
+	if !o.Cancelled() {
+		t.Error("the order that could not be built was not cancelled")
+	}
+	if n := store.InStorage(); n != 1 {
+		t.Errorf("%d unicorns in storage, want 1", n)
+	}
+}
+
+func TestBuildLineProduction(t *testing.T) {
+	bl, err := NewBuildLine(&testBuilder{}, NewLogisticsCenter(lifo.New()), time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	completed := make(chan *order, 1)
+	bl.OnCompleted(func(o *order) { completed <- o })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bl.StartProduction(ctx)
+
+	o := newBuildOrder("order", 2, unicorn.PriorityNormal)
+	bl.AddOrder(o)
+
+	select {
+	case got := <-completed:
+		if got != o {
+			t.Errorf("completed order %s, want %s", got.ID, o.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the order was not built")
+	}
+}
+
+func TestNewBuildLineRate(t *testing.T) {
+	if _, err := NewBuildLine(&testBuilder{}, NewLogisticsCenter(lifo.New()), 0); !errors.Is(err, unicorn.ErrInvalidRate) {
+		t.Errorf("err = %v, want %v", err, unicorn.ErrInvalidRate)
+	}
+}
@@ -0,0 +1,155 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicorn"
+)
+
+var (
+	ErrOrderIDCollision = errors.New("could not generate a unique order ID")
+)
+
+// Attempts at generating an order ID not given to another order, before giving up.
+const maxOrderIDAttempts = 8
+
+// Length of a Order ID.
+// Exported so that it can be changed by developers.
+var OrderIDLength = 16
+
+// IDGenerator generates order IDs.
+// Order IDs are all it takes to poll an order, so they must not be guessable.
+type IDGenerator interface {
+	NewID() (unicorn.OrderID, error)
+}
+
+// entropy serializes the reads from a source of random bytes.
+type entropy struct {
+	mu sync.Mutex
+	r  io.Reader
+}
+
+// newEntropy reads random bytes from r, or from the cryptographically secure generator if nil.
+func newEntropy(r io.Reader) *entropy {
+	if r == nil {
+		r = rand.Reader
+	}
+	return &entropy{r: r}
+}
+
+func (e *entropy) read(b []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, err := io.ReadFull(e.r, b)
+	return err
+}
+
+const charset = "aAbBcCdDeEfFgGhHiIjJkKlLmMnNoOpPqQrRsStTuUvVwWxXyYzZ1234567890"
+
+type randomIDs struct {
+	entropy *entropy
+	length  int
+}
+
+// NewRandomIDs generates alphanumeric order IDs, length characters long,
+// drawn from src or from the cryptographically secure generator if nil.
+func NewRandomIDs(length int, src io.Reader) IDGenerator {
+	return &randomIDs{entropy: newEntropy(src), length: length}
+}
+
+func (g *randomIDs) NewID() (unicorn.OrderID, error) {
+	// bytes past the largest multiple of the charset length are discarded,
+	// so that every character is equally likely.
+	const limit = 256 - 256%len(charset)
+
+	id := make([]byte, 0, g.length)
+	b := make([]byte, g.length)
+
+	for len(id) < g.length {
+		if err := g.entropy.read(b); err != nil {
+			return "", err
+		}
+
+		for _, c := range b {
+			if int(c) < limit && len(id) < g.length {
+				id = append(id, charset[int(c)%len(charset)])
+			}
+		}
+	}
+
+	return unicorn.OrderID(id), nil
+}
+
+// Crockford's base 32 alphabet, used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+type ulids struct {
+	entropy *entropy
+}
+
+// NewULIDs generates ULIDs as order IDs: 26 characters, sorted by the time they
+// were generated, to the millisecond. The random part is drawn from src or
+// from the cryptographically secure generator if nil.
+func NewULIDs(src io.Reader) IDGenerator {
+	return &ulids{entropy: newEntropy(src)}
+}
+
+func (g *ulids) NewID() (unicorn.OrderID, error) {
+	var b [16]byte
+
+	// 48 bits of the time in milliseconds, followed by 80 random bits
+	ms := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint16(b[:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+
+	if err := g.entropy.read(b[6:]); err != nil {
+		return "", err
+	}
+
+	// encode the 128 bits, 5 at a time from the least significant
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+
+	var id [26]byte
+	for i := len(id) - 1; i >= 0; i-- {
+		id[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return unicorn.OrderID(id[:]), nil
+}
+
+type uuids struct {
+	entropy *entropy
+}
+
+// NewUUIDs generates version 4 UUIDs as order IDs, drawn from src
+// or from the cryptographically secure generator if nil.
+func NewUUIDs(src io.Reader) IDGenerator {
+	return &uuids{entropy: newEntropy(src)}
+}
+
+func (g *uuids) NewID() (unicorn.OrderID, error) {
+	var b [16]byte
+	if err := g.entropy.read(b[:]); err != nil {
+		return "", err
+	}
+
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+	return unicorn.OrderID(fmt.Sprintf("%s-%s-%s-%s-%s",
+		hex.EncodeToString(b[:4]),
+		hex.EncodeToString(b[4:6]),
+		hex.EncodeToString(b[6:8]),
+		hex.EncodeToString(b[8:10]),
+		hex.EncodeToString(b[10:]),
+	)), nil
+}
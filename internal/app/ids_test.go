@@ -0,0 +1,111 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"regexp"
+	"testing"
+	"time"
+	"unicorn"
+	"unicorn/storage/lifo"
+)
+
+func TestIDFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		gen    IDGenerator
+		format *regexp.Regexp
+	}{
+		{"random", NewRandomIDs(OrderIDLength, nil), regexp.MustCompile(`^[a-zA-Z0-9]{16}$`)},
+		{"ulid", NewULIDs(nil), regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)},
+		{"uuid", NewUUIDs(nil), regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make(map[unicorn.OrderID]struct{})
+
+			for i := 0; i < 1000; i++ {
+				id, err := tt.gen.NewID()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !tt.format.MatchString(string(id)) {
+					t.Fatalf("ID %q does not match %s", id, tt.format)
+				}
+				if _, ok := seen[id]; ok {
+					t.Fatalf("ID %q was generated twice", id)
+				}
+				seen[id] = struct{}{}
+			}
+		})
+	}
+}
+
+func TestULIDsSortByTime(t *testing.T) {
+	gen := NewULIDs(nil)
+
+	first, err := gen.NewID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+
+	second, err := gen.NewID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first >= second {
+		t.Errorf("ULID %s generated before %s sorts after it", first, second)
+	}
+}
+
+func TestSeededIDs(t *testing.T) {
+	for _, newGen := range []func(src *rand.Rand) IDGenerator{
+		func(src *rand.Rand) IDGenerator { return NewRandomIDs(OrderIDLength, src) },
+		func(src *rand.Rand) IDGenerator { return NewUUIDs(src) },
+	} {
+		first, second := newGen(rand.New(rand.NewSource(42))), newGen(rand.New(rand.NewSource(42)))
+
+		for i := 0; i < 10; i++ {
+			a, err := first.NewID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := second.NewID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a != b {
+				t.Fatalf("generators with the same seed generated %q and %q", a, b)
+			}
+		}
+	}
+}
+
+func TestOrderIDCollision(t *testing.T) {
+	// the same bytes every time, for the same ID every time.
+	ids := NewRandomIDs(OrderIDLength, &repeatReader{b: 'a'})
+	svc := New(NewLogisticsCenter(lifo.New()), WithOrderIDs(ids))
+
+	if _, err := svc.OrderUnicorns(1); err != nil {
+		t.Fatalf("first order: %v", err)
+	}
+
+	if _, err := svc.OrderUnicorns(1); !errors.Is(err, ErrOrderIDCollision) {
+		t.Errorf("second order: err = %v, want %v", err, ErrOrderIDCollision)
+	}
+}
+
+// repeatReader reads the same byte forever.
+type repeatReader struct {
+	b byte
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	copy(p, bytes.Repeat([]byte{r.b}, len(p)))
+	return len(p), nil
+}
@@ -2,27 +2,111 @@ package app
 
 import (
 	"sync"
+	"time"
 	"unicorn"
-	"unicorn/pkg/queue"
+	"unicorn/pkg/pqueue"
 	"unicorn/storage"
 )
 
 type logisticsCenter struct {
 	mu sync.RWMutex
 
-	current *order                 // current order to fulfill. must be always non nil.
-	queue   *queue.Queue[*order]   // queue of order to fulfill
-	store   storage.UnicornStorage // unicorn store for excedent production
+	active []*order                      // orders being fulfilled, in the order they left the queue
+	queue  *pqueue.PriorityQueue[*order] // queue of order to fulfill, by priority
+	store  storage.UnicornStorage        // unicorn store for excedent production
+
+	allocation Allocation // of the production among the active orders
+
+	aging time.Duration // waiting time for an order to be promoted one priority. no aging if zero.
+	now   time.Time     // reference time to compare the orders priority
+
+	completed func(*order) // called when the production of an order has completed
+	recorder  Recorder     // of the unicorns history
+
+	dropped int // unicorns given back by orders, discarded for not fitting in storage
+}
+
+// LogisticsOption is function used to customize the logistics center.
+type LogisticsOption func(*logisticsCenter)
+
+// WithAllocation sets the strategy to allocate the production among the orders.
+// Orders are fulfilled one at a time, by FIFO, by default.
+func WithAllocation(a Allocation) LogisticsOption {
+	return func(lc *logisticsCenter) {
+		if a != nil {
+			lc.allocation = a
+		}
+	}
+}
+
+// WithAging promotes the queued orders one priority for every period they wait,
+// so that low priority orders are not starved by higher priority ones.
+func WithAging(period time.Duration) LogisticsOption {
+	return func(lc *logisticsCenter) {
+		lc.aging = period
+	}
+}
+
+// WithRecorder records the history of the unicorns handled by the logistics center
+// and its production.
+func WithRecorder(r Recorder) LogisticsOption {
+	return func(lc *logisticsCenter) {
+		if r != nil {
+			lc.recorder = r
+		}
+	}
+}
+
+func NewLogisticsCenter(store storage.UnicornStorage, options ...LogisticsOption) *logisticsCenter {
+	lc := &logisticsCenter{
+		store:      store,
+		allocation: FIFO(),
+		recorder:   nopRecorder{},
+	}
+
+	lc.queue = pqueue.New(lc.before)
+
+	for _, opt := range options {
+		if opt != nil {
+			opt(lc)
+		}
+	}
+
+	return lc
 }
 
-func NewLogisticsCenter(store storage.UnicornStorage) *logisticsCenter {
-	queue := queue.New[*order]()
+// before reports whether order a must be fulfilled before order b.
+// Orders of equal priority are fulfilled First In First Out by the queue.
+func (lc *logisticsCenter) before(a, b *order) bool {
+	return lc.priority(a) > lc.priority(b)
+}
 
-	return &logisticsCenter{
-		current: NewOrder(0), // select a fake zero amount order. This facilitates the logic.
-		queue:   queue,
-		store:   store,
+// priority returns the order priority, promoted by the time it has been waiting.
+func (lc *logisticsCenter) priority(o *order) unicorn.Priority {
+	if lc.aging <= 0 {
+		return o.priority
 	}
+
+	return o.priority + unicorn.Priority(lc.now.Sub(o.created)/lc.aging)
+}
+
+// prioritize reorders the queue by the current orders priority.
+// Must be called with the lock held.
+func (lc *logisticsCenter) prioritize() {
+	lc.now = time.Now()
+
+	if lc.aging > 0 {
+		lc.queue.Fix()
+	}
+}
+
+// OnCompleted sets a function to be called when the production of an order has completed.
+// It is called with the logistics center locked, so it must not block.
+func (lc *logisticsCenter) OnCompleted(fn func(*order)) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	lc.completed = fn
 }
 
 func (lc *logisticsCenter) AddOrder(order *order) {
@@ -32,39 +116,229 @@ func (lc *logisticsCenter) AddOrder(order *order) {
 	if lc.store.InStorage() > 0 {
 		pending := order.amount - order.produced
 
-		unicorns := lc.store.Collect(pending)
+		var unicorns []*unicorn.Unicorn
+		if order.filter.Empty() {
+			unicorns = lc.store.Collect(pending)
+		} else {
+			unicorns = lc.store.CollectMatching(pending, order.filter.Match)
+		}
 
 		for _, u := range unicorns {
 			if !order.Add(u) {
-				lc.store.Store(u)
+				// room was just made by collecting it, unless the storage filled up since.
+				if err := lc.store.Store(u); err != nil {
+					lc.dropped++
+				}
+				continue
 			}
+			lc.recorder.Assigned(u, order.ID)
 		}
 	}
 
-	lc.queue.Enqueue(order)
+	if order.ProductionHasCompleted() {
+		lc.complete(order)
+		return
+	}
+
+	lc.prioritize()
+	lc.queue.Push(order)
 }
 
-func (lc *logisticsCenter) HandleUnicorn(unicorn *unicorn.Unicorn) {
+// RestoreOrder queues a previously persisted order, without collecting unicorns from storage.
+func (lc *logisticsCenter) RestoreOrder(order *order) {
 	lc.mu.Lock()
 	defer lc.mu.Unlock()
 
-	lc.updateCurrentOrder()
+	lc.prioritize()
+	lc.queue.Push(order)
+}
 
-	if !lc.current.Add(unicorn) {
-		lc.store.Store(unicorn)
+// PendingOrders returns the orders waiting for production, in the order they will be fulfilled.
+func (lc *logisticsCenter) PendingOrders() []*order {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	orders := make([]*order, 0, len(lc.active)+lc.queue.Len())
+	for _, o := range lc.active {
+		if !o.ProductionHasCompleted() {
+			orders = append(orders, o)
+		}
 	}
+
+	lc.prioritize()
+	return append(orders, lc.queue.Items()...)
 }
 
-func (lc *logisticsCenter) updateCurrentOrder() {
-	// if the production has not ended, keep it in production.
-	if !lc.current.ProductionHasCompleted() {
-		return
+// PendingProduction returns the number of unicorns left to produce for all pending orders.
+func (lc *logisticsCenter) PendingProduction() int {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+
+	pending := 0
+	for _, o := range lc.active {
+		pending += o.PendingProduction()
+	}
+
+	lc.queue.Each(func(o *order) {
+		pending += o.PendingProduction()
+	})
+
+	return pending
+}
+
+// Dropped returns the number of unicorns given back by orders, such as cancelled ones,
+// that were discarded for not fitting in storage.
+func (lc *logisticsCenter) Dropped() int {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+
+	return lc.dropped
+}
+
+// InStorage returns the number of unicorns in storage.
+func (lc *logisticsCenter) InStorage() int {
+	return lc.store.InStorage()
+}
+
+// CancelOrder removes an order from the logistics queue.
+// Its produced unicorns that were not collected are given back as new production.
+// It returns the number of them that were discarded for not fitting in storage.
+func (lc *logisticsCenter) CancelOrder(cancelled *order) int {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	unicorns := cancelled.Cancel()
+
+	if !lc.deactivate(cancelled) {
+		lc.queue.RemoveFunc(func(o *order) bool { return o == cancelled })
+	}
+
+	return lc.giveBack(unicorns)
+}
+
+// GiveBack hands unicorns that an order will not collect back as new production:
+// to the pending orders accepting them, or else to storage.
+// It returns the number of them that were discarded for not fitting in storage.
+func (lc *logisticsCenter) GiveBack(unicorns []*unicorn.Unicorn) int {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	return lc.giveBack(unicorns)
+}
+
+// giveBack hands unicorns back as new production, counting the ones discarded.
+// Must be called with the lock held.
+func (lc *logisticsCenter) giveBack(unicorns []*unicorn.Unicorn) int {
+	dropped := 0
+	for _, u := range unicorns {
+		lc.recorder.Assigned(u, "")
+		if err := lc.handle(u); err != nil {
+			dropped++
+		}
+	}
+
+	lc.dropped += dropped
+	return dropped
+}
+
+// HandleUnicorn gives a new unicorn to a pending order, or stores it.
+// It returns the storage error if the unicorn could not be stored.
+func (lc *logisticsCenter) HandleUnicorn(unicorn *unicorn.Unicorn) error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	return lc.handle(unicorn)
+}
+
+// handle gives a unicorn to a pending order accepting it, or stores it if there is none.
+// Must be called with the lock held.
+func (lc *logisticsCenter) handle(unicorn *unicorn.Unicorn) error {
+	lc.updateActiveOrders()
+
+	assigned, queued := lc.assign(unicorn)
+	if assigned == nil || !assigned.Add(unicorn) {
+		return lc.store.Store(unicorn)
+	}
+	lc.recorder.Assigned(unicorn, assigned.ID)
+
+	if assigned.ProductionHasCompleted() {
+		if queued {
+			lc.queue.RemoveFunc(func(o *order) bool { return o == assigned })
+		}
+		lc.complete(assigned)
+	}
+
+	return nil
+}
+
+// assign chooses the order to give a unicorn to: one of the active orders accepting it,
+// by the allocation strategy, or else the first queued order accepting it.
+// It returns nil if no order accepts the unicorn, and whether the order is queued.
+// Must be called with the lock held.
+func (lc *logisticsCenter) assign(unicorn *unicorn.Unicorn) (*order, bool) {
+	candidates := make([]*order, 0, len(lc.active))
+	for _, o := range lc.active {
+		if o.Accepts(unicorn) {
+			candidates = append(candidates, o)
+		}
+	}
+
+	if len(candidates) > 0 {
+		return candidates[lc.allocation.next(candidates)], false
 	}
 
-	// in case that no other orders are available, keep the current one.
 	if lc.queue.Empty() {
+		return nil, false
+	}
+
+	lc.prioritize()
+	for _, o := range lc.queue.Items() {
+		if o.Accepts(unicorn) {
+			return o, true
+		}
+	}
+
+	return nil, false
+}
+
+// complete notifies that the production of an order has completed.
+func (lc *logisticsCenter) complete(order *order) {
+	if lc.completed != nil {
+		lc.completed(order)
+	}
+}
+
+// updateActiveOrders replaces the orders whose production has completed
+// with the next ones in the queue, up to the allocation width.
+func (lc *logisticsCenter) updateActiveOrders() {
+	active := lc.active[:0]
+	for _, o := range lc.active {
+		if !o.ProductionHasCompleted() {
+			active = append(active, o)
+		}
+	}
+	for i := len(active); i < len(lc.active); i++ {
+		lc.active[i] = nil // do not retain the completed orders
+	}
+	lc.active = active
+
+	if len(lc.active) >= lc.allocation.width() || lc.queue.Empty() {
 		return
 	}
 
-	lc.current = lc.queue.Dequeue()
+	lc.prioritize()
+	for len(lc.active) < lc.allocation.width() && !lc.queue.Empty() {
+		lc.active = append(lc.active, lc.queue.Pop())
+	}
+}
+
+// deactivate removes an order from the active orders. It returns true if it was active.
+func (lc *logisticsCenter) deactivate(order *order) bool {
+	for i, o := range lc.active {
+		if o == order {
+			lc.active = append(lc.active[:i], lc.active[i+1:]...)
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,319 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"unicorn"
+	"unicorn/storage"
+	"unicorn/storage/lifo"
+)
+
+// newTestOrder creates an order of amount unicorns, filtered to the required capabilities.
+func newTestOrder(id string, amount uint, required ...string) *order {
+	o := NewOrder(unicorn.OrderID(id), amount)
+	if len(required) > 0 {
+		o.filter = unicorn.CapabilityFilter{Required: required}
+	}
+	return o
+}
+
+// produce hands n new unicorns with the capabilities to the logistics center.
+func produce(t *testing.T, lc *logisticsCenter, n int, capabilities ...string) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		u := &unicorn.Unicorn{ID: fmt.Sprint(i), Capabilities: capabilities}
+		if err := lc.HandleUnicorn(u); err != nil {
+			t.Fatalf("handling unicorn: %v", err)
+		}
+	}
+}
+
+// produced returns how many unicorns each order received.
+func produced(orders ...*order) []int {
+	counts := make([]int, len(orders))
+	for i, o := range orders {
+		counts[i] = o.Status().Produced
+	}
+	return counts
+}
+
+func equalCounts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAllocation(t *testing.T) {
+	tests := []struct {
+		name       string
+		allocation Allocation
+		amounts    []uint
+		unicorns   int
+		want       []int // unicorns produced for each order
+	}{
+		{"fifo", FIFO(), []uint{3, 3, 3}, 4, []int{3, 1, 0}},
+		{"round-robin", RoundRobin(2), []uint{3, 3, 3}, 4, []int{2, 2, 0}},
+		{"round-robin refilled", RoundRobin(2), []uint{1, 3, 3}, 4, []int{1, 1, 2}},
+		{"round-robin wider than the queue", RoundRobin(4), []uint{2, 2}, 3, []int{2, 1}},
+		{"proportional", Proportional(2), []uint{2, 6, 3}, 4, []int{1, 3, 0}},
+		{"proportional refilled", Proportional(2), []uint{1, 2, 2}, 4, []int{1, 2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lc := NewLogisticsCenter(lifo.New(), WithAllocation(tt.allocation))
+
+			orders := make([]*order, len(tt.amounts))
+			for i, amount := range tt.amounts {
+				orders[i] = newTestOrder(fmt.Sprint(i), amount)
+				lc.AddOrder(orders[i])
+			}
+
+			produce(t, lc, tt.unicorns)
+
+			if got := produced(orders...); !equalCounts(got, tt.want) {
+				t.Errorf("produced %v, want %v", got, tt.want)
+			}
+			if n := lc.InStorage(); n != 0 {
+				t.Errorf("%d unicorns in storage, want 0", n)
+			}
+		})
+	}
+}
+
+func TestAllocationRejectedByActiveOrders(t *testing.T) {
+	lc := NewLogisticsCenter(lifo.New(), WithAllocation(RoundRobin(2)))
+
+	flying := newTestOrder("flying", 2, "fly")
+	swimming := newTestOrder("swimming", 2, "swim")
+	queued := newTestOrder("queued", 2)
+	for _, o := range []*order{flying, swimming, queued} {
+		lc.AddOrder(o)
+	}
+
+	// the active orders reject them, so the first queued order accepting them receives them.
+	produce(t, lc, 2, "sing")
+
+	if got, want := produced(flying, swimming, queued), []int{0, 0, 2}; !equalCounts(got, want) {
+		t.Errorf("produced %v, want %v", got, want)
+	}
+
+	// no order accepts them, so they are stored.
+	produce(t, lc, 1, "sing")
+
+	if n := lc.InStorage(); n != 1 {
+		t.Errorf("%d unicorns in storage, want 1", n)
+	}
+}
+
+func TestAllocationCompletesOrders(t *testing.T) {
+	var completed []unicorn.OrderID
+
+	lc := NewLogisticsCenter(lifo.New(), WithAllocation(RoundRobin(2)))
+	lc.OnCompleted(func(o *order) { completed = append(completed, o.ID) })
+
+	first, second := newTestOrder("first", 1), newTestOrder("second", 2)
+	lc.AddOrder(first)
+	lc.AddOrder(second)
+
+	produce(t, lc, 3)
+
+	if len(completed) != 2 || completed[0] != first.ID || completed[1] != second.ID {
+		t.Errorf("completed %v, want [first second]", completed)
+	}
+	if n := lc.PendingProduction(); n != 0 {
+		t.Errorf("%d unicorns pending production, want 0", n)
+	}
+}
+
+func TestCancelOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		cancel    int   // index of the cancelled order
+		want      []int // unicorns produced for the other orders
+		inStorage int
+	}{
+		{"active", 0, []int{2}, 0},
+		{"queued", 1, []int{2}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lc := NewLogisticsCenter(lifo.New())
+
+			orders := []*order{newTestOrder("first", 3), newTestOrder("second", 2)}
+			for _, o := range orders {
+				lc.AddOrder(o)
+			}
+			produce(t, lc, 2) // to the first order, the active one.
+
+			cancelled := orders[tt.cancel]
+			if dropped := lc.CancelOrder(cancelled); dropped != 0 {
+				t.Errorf("dropped %d unicorns, want 0", dropped)
+			}
+
+			others := append(append([]*order{}, orders[:tt.cancel]...), orders[tt.cancel+1:]...)
+			if got := produced(others...); !equalCounts(got, tt.want) {
+				t.Errorf("produced %v for the other orders, want %v", got, tt.want)
+			}
+			if n := lc.InStorage(); n != tt.inStorage {
+				t.Errorf("%d unicorns in storage, want %d", n, tt.inStorage)
+			}
+
+			// the cancelled order is out of the queue, and accepts no more unicorns.
+			for _, o := range lc.PendingOrders() {
+				if o == cancelled {
+					t.Error("the cancelled order is still pending")
+				}
+			}
+			if cancelled.Accepts(&unicorn.Unicorn{}) {
+				t.Error("the cancelled order accepts unicorns")
+			}
+		})
+	}
+}
+
+func TestCancelOrderToStock(t *testing.T) {
+	lc := NewLogisticsCenter(lifo.New())
+
+	o := newTestOrder("order", 3)
+	lc.AddOrder(o)
+	produce(t, lc, 2)
+
+	lc.CancelOrder(o)
+
+	if n := lc.InStorage(); n != 2 {
+		t.Errorf("%d unicorns in storage, want 2", n)
+	}
+	if n := lc.PendingProduction(); n != 0 {
+		t.Errorf("%d unicorns pending production, want 0", n)
+	}
+}
+
+func TestCancelOrderDropped(t *testing.T) {
+	lc := NewLogisticsCenter(lifo.New(storage.WithCapacity(1, storage.DropNewest)))
+
+	o := newTestOrder("order", 3)
+	lc.AddOrder(o)
+	produce(t, lc, 3)
+
+	if dropped := lc.CancelOrder(o); dropped != 2 {
+		t.Errorf("dropped %d unicorns, want 2", dropped)
+	}
+	if n := lc.Dropped(); n != 2 {
+		t.Errorf("%d unicorns dropped in total, want 2", n)
+	}
+}
+
+func TestPriority(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		aging time.Duration
+		want  []int // unicorns produced for the low, normal and high priority orders
+	}{
+		{"by priority", 0, []int{0, 0, 1}},
+		// the low priority order waited long enough to be promoted twice, ahead of the high one.
+		{"aging", time.Minute, []int{1, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lc := NewLogisticsCenter(lifo.New(), WithAging(tt.aging))
+
+			low, normal, high := newTestOrder("low", 1), newTestOrder("normal", 1), newTestOrder("high", 1)
+			low.priority, low.created = unicorn.PriorityLow, now.Add(-3*time.Minute)
+			normal.priority, normal.created = unicorn.PriorityNormal, now.Add(-30*time.Second)
+			high.priority, high.created = unicorn.PriorityHigh, now
+
+			for _, o := range []*order{normal, low, high} {
+				lc.AddOrder(o)
+			}
+
+			produce(t, lc, 1)
+
+			if got := produced(low, normal, high); !equalCounts(got, tt.want) {
+				t.Errorf("produced %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriorityFIFO(t *testing.T) {
+	lc := NewLogisticsCenter(lifo.New())
+
+	first, second, third := newTestOrder("first", 1), newTestOrder("second", 1), newTestOrder("third", 1)
+	third.priority = unicorn.PriorityHigh
+	for _, o := range []*order{first, second, third} {
+		lc.AddOrder(o)
+	}
+
+	pending := lc.PendingOrders()
+	if len(pending) != 3 || pending[0] != third || pending[1] != first || pending[2] != second {
+		t.Errorf("pending orders in the wrong order")
+	}
+}
+
+func TestFilteredOrders(t *testing.T) {
+	store := lifo.New()
+	for _, u := range []*unicorn.Unicorn{
+		{ID: "a", Capabilities: []string{"fly"}},
+		{ID: "b", Capabilities: []string{"swim"}},
+		{ID: "c", Capabilities: []string{"fly", "swim"}},
+	} {
+		if err := store.Store(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lc := NewLogisticsCenter(store)
+
+	// only the matching unicorns are collected from stock.
+	flying := newTestOrder("flying", 3, "fly")
+	lc.AddOrder(flying)
+
+	if got := flying.Status().Produced; got != 2 {
+		t.Errorf("collected %d unicorns from stock, want 2", got)
+	}
+	if n := lc.InStorage(); n != 1 {
+		t.Errorf("%d unicorns in storage, want 1", n)
+	}
+
+	excluding := newTestOrder("excluding", 1)
+	excluding.filter = unicorn.CapabilityFilter{Excluded: []string{"fly"}}
+	lc.AddOrder(excluding)
+
+	if got := excluding.Status().Produced; got != 1 {
+		t.Errorf("collected %d unicorns from stock, want 1", got)
+	}
+
+	// the filtered order skips the unicorns it does not match, which are stored.
+	produce(t, lc, 1, "swim")
+
+	if got := flying.Status().Produced; got != 2 {
+		t.Errorf("produced %d unicorns for the flying order, want 2", got)
+	}
+	if n := lc.InStorage(); n != 1 {
+		t.Errorf("%d unicorns in storage, want 1", n)
+	}
+
+	produce(t, lc, 1, "fly")
+
+	if !flying.ProductionHasCompleted() {
+		t.Error("the flying order was not completed")
+	}
+	for _, u := range flying.Collect() {
+		if !u.Has("fly") {
+			t.Errorf("unicorn %s without the required capability", u.ID)
+		}
+	}
+}
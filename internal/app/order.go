@@ -1,35 +1,101 @@
 package app
 
 import (
-	"math/rand"
+	"context"
 	"sync"
+	"time"
 	"unicorn"
 	"unicorn/pkg/queue"
 )
 
-// Length of a Order ID.
-// Exported so that it can be changed by developers.
-var OrderIDLength = 16
-
 type order struct {
-	ID unicorn.OrderID
+	ID       unicorn.OrderID
+	callback string        // URL to notify once the production has completed.
+	ttl      time.Duration // to keep the order without being polled. never expires if zero.
+	priority unicorn.Priority
+	created  time.Time
+	filter   unicorn.CapabilityFilter // the order unicorns must match.
+	spec     *unicorn.Spec            // of custom-built unicorns. not custom-built if nil.
 
 	mu       sync.RWMutex
 	amount   int // of unicorns to fullfil this order.
 	produced int // how many unicorn have been produced for this order.
 	sent     int // how many unicorns have been shipped to clients.
 
+	cancelled  bool      // cancelled orders do not accept more unicorns.
+	seen       time.Time // last time the order was polled.
+	delivering bool      // queued or in flight for delivery to the callback.
+
 	ready *queue.Queue[*unicorn.Unicorn] // unicorn ready for been collected.
+
+	changed chan struct{} // closed and replaced whenever a unicorn is added. closed on cancellation.
 }
 
 // NewOrder creates a new unicorn production order.
-func NewOrder(amount uint) *order {
-	id := randomID(OrderIDLength)
+func NewOrder(id unicorn.OrderID, amount uint) *order {
+	now := time.Now()
 
 	return &order{
-		ID:     unicorn.OrderID(id),
-		amount: int(amount),
-		ready:  queue.New[*unicorn.Unicorn](),
+		ID:      id,
+		amount:  int(amount),
+		ready:   queue.New[*unicorn.Unicorn](),
+		changed: make(chan struct{}),
+		created: now,
+		seen:    now,
+	}
+}
+
+// restoreOrder recreates an order from its snapshot.
+func restoreOrder(snap OrderSnapshot) *order {
+	o := &order{
+		ID:       snap.ID,
+		callback: snap.Callback,
+		ttl:      snap.TTL,
+		priority: snap.Priority,
+		created:  snap.CreatedAt,
+		filter:   snap.Capabilities,
+		spec:     snap.Spec,
+		amount:   snap.Amount,
+		produced: snap.Produced,
+		sent:     snap.Sent,
+		ready:    queue.New[*unicorn.Unicorn](),
+		changed:  make(chan struct{}),
+		seen:     time.Now(), // clients could not poll while the order was persisted.
+	}
+
+	if o.created.IsZero() {
+		o.created = o.seen
+	}
+
+	for _, u := range snap.Ready {
+		o.ready.Enqueue(u)
+	}
+
+	return o
+}
+
+// Snapshot returns the current state of the order.
+func (o *order) Snapshot() OrderSnapshot {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	ready := make([]*unicorn.Unicorn, 0, o.ready.Len())
+	o.ready.Each(func(u *unicorn.Unicorn) {
+		ready = append(ready, u)
+	})
+
+	return OrderSnapshot{
+		ID:           o.ID,
+		Callback:     o.callback,
+		TTL:          o.ttl,
+		Priority:     o.priority,
+		CreatedAt:    o.created,
+		Capabilities: o.filter,
+		Spec:         o.spec,
+		Amount:       o.amount,
+		Produced:     o.produced,
+		Sent:         o.sent,
+		Ready:        ready,
 	}
 }
 
@@ -48,20 +114,154 @@ func (o *order) Collect() []*unicorn.Unicorn {
 	return unicorns
 }
 
+// Return gives back collected unicorns that could not be shipped, so they can be collected again.
+// It returns false if the order was cancelled in the meantime, leaving the unicorns to the caller.
+func (o *order) Return(unicorns []*unicorn.Unicorn) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.cancelled {
+		return false
+	}
+
+	for _, u := range unicorns {
+		o.ready.Enqueue(u)
+	}
+	o.sent -= len(unicorns)
+
+	return true
+}
+
+// Accepts reports whether a unicorn from stock or the regular production can be added to the order.
+// Custom-built orders only accept the unicorns built for them.
+func (o *order) Accepts(unicorn *unicorn.Unicorn) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	return o.spec == nil && o.accepts(unicorn)
+}
+
+// CustomBuilt indicates if the order unicorns are custom-built.
+func (o *order) CustomBuilt() bool {
+	return o.spec != nil
+}
+
+// accepts reports whether the unicorn can be added to the order.
+// Must be called with the lock held.
+func (o *order) accepts(unicorn *unicorn.Unicorn) bool {
+	return o.amount != o.produced && !o.cancelled && o.filter.Match(unicorn)
+}
+
 // Add unicorn to order. It returns ok.
 func (o *order) Add(unicorn *unicorn.Unicorn) bool {
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
-	if o.amount == o.produced {
+	if !o.accepts(unicorn) {
 		return false
 	}
 
 	o.ready.Enqueue(unicorn)
 	o.produced++
+
+	close(o.changed)
+	o.changed = make(chan struct{})
+
 	return true
 }
 
+// Wait blocks until the order has unicorns ready to be collected,
+// its production has completed or ctx is done.
+func (o *order) Wait(ctx context.Context) error {
+	o.mu.RLock()
+	changed := o.changed
+	done := !o.ready.Empty() || o.amount == o.produced || o.cancelled
+	o.mu.RUnlock()
+
+	if done {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-changed:
+		return nil
+	}
+}
+
+// Cancel cancels the order and returns its produced unicorns that were not collected.
+func (o *order) Cancel() []*unicorn.Unicorn {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.cancelled {
+		return nil
+	}
+
+	o.cancelled = true
+	close(o.changed)
+
+	return o.ready.DequeueAll()
+}
+
+// Cancelled indicates if the order has been cancelled.
+func (o *order) Cancelled() bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	return o.cancelled
+}
+
+// Touch marks the order as polled.
+func (o *order) Touch() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.seen = time.Now()
+}
+
+// SetDelivering marks the order as queued or in flight for delivery to its callback, or not anymore.
+func (o *order) SetDelivering(delivering bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.delivering = delivering
+}
+
+// Expired indicates if the order has not been polled within its TTL.
+// Orders waiting for the production or the delivery to notify their callback do not expire,
+// as callback clients do not poll.
+func (o *order) Expired(now time.Time) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	if o.ttl == 0 || o.delivering || (o.callback != "" && o.amount != o.produced) {
+		return false
+	}
+
+	return now.Sub(o.seen) > o.ttl
+}
+
+// Status returns the progress of the order.
+func (o *order) Status() unicorn.OrderStatus {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	return unicorn.OrderStatus{
+		ID:        o.ID,
+		Priority:  o.priority,
+		Amount:    o.amount,
+		Produced:  o.produced,
+		Ready:     o.ready.Len(),
+		Delivered: o.sent,
+		Pending:   o.amount - o.produced,
+
+		Capabilities: o.filter,
+		Spec:         o.spec,
+	}
+}
+
 // ProductionHasCompleted indicates if the production for this order has been completed.
 func (o *order) ProductionHasCompleted() bool {
 	o.mu.RLock()
@@ -78,23 +278,22 @@ func (o *order) IsFulfilled() bool {
 	return o.amount == o.sent
 }
 
-// PendingProduction returns the number of unicorns that are left to fulfill the order.
-func (o *order) PendingProduction() int {
+// progress returns the fraction of the order that has been produced.
+func (o *order) progress() float64 {
 	o.mu.RLock()
 	defer o.mu.RUnlock()
 
-	return o.amount - o.produced
-}
-
-const charset = "aAbBcCdDeEfFgGhHiIjJkKlLmMnNoOpPqQrRsStTuUvVwWxXyYzZ1234567890"
+	if o.amount == 0 {
+		return 1
+	}
 
-// randomID generates a random identifier n characters long.
-func randomID(n int) string {
-	b := make([]byte, n)
+	return float64(o.produced) / float64(o.amount)
+}
 
-	for i := 0; i < len(b); i++ {
-		b[i] = charset[rand.Intn(len(charset)-1)]
-	}
+// PendingProduction returns the number of unicorns that are left to fulfill the order.
+func (o *order) PendingProduction() int {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
 
-	return string(b)
+	return o.amount - o.produced
 }
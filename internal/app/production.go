@@ -2,31 +2,377 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
+	"unicorn"
 	"unicorn/factory"
+	"unicorn/storage"
 )
 
 type productionLine struct {
+	id       int
 	factory  factory.Factory
 	logistic *logisticsCenter
+
+	mu       sync.RWMutex
+	rate     time.Duration // period in which a unicorn is produced
+	paused   bool          // paused lines do not produce
+	produced int           // unicorns produced by the line
+	dropped  int           // unicorns discarded for not fitting in storage
+
+	held *unicorn.Unicorn // unicorn waiting for room in storage. no production while held.
+
+	changed chan struct{} // signals a rate or state change
 }
 
-// NewProductionLine creates a new production line.
-func NewProductionLine(factory factory.Factory, logistics *logisticsCenter) *productionLine {
+// NewProductionLine creates a new production line, producing a unicorn at every rate.
+func NewProductionLine(factory factory.Factory, logistics *logisticsCenter, rate time.Duration) (*productionLine, error) {
+	if rate <= 0 {
+		return nil, unicorn.ErrInvalidRate
+	}
+
 	return &productionLine{
 		factory:  factory,
 		logistic: logistics,
-	}
+		rate:     rate,
+		changed:  make(chan struct{}, 1),
+	}, nil
 }
 
-// StartProduction starts producing unicorns at rate.
-func (pl *productionLine) StartProduction(ctx context.Context, rate time.Duration) {
+// StartProduction starts producing unicorns until ctx is done.
+func (pl *productionLine) StartProduction(ctx context.Context) {
+	timer := time.NewTimer(pl.Rate())
+	defer timer.Stop()
+
+	stopTimer(timer) // scheduled below, unless paused.
+	pl.schedule(timer)
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-time.After(rate):
-			pl.logistic.HandleUnicorn(pl.factory.NewUnicorn())
+		case <-pl.changed:
+			stopTimer(timer)
+			pl.schedule(timer)
+		case <-timer.C:
+			pl.produce()
+			pl.schedule(timer)
 		}
 	}
 }
+
+// produce a unicorn and hand it to logistics.
+// While the storage is full with backpressure, the line holds the unicorn and retries
+// handling it instead of producing new ones.
+func (pl *productionLine) produce() {
+	pl.mu.Lock()
+	u := pl.held
+	if u == nil {
+		u = pl.factory.NewUnicorn()
+		pl.produced++
+		pl.logistic.recorder.Produced(u)
+	}
+	pl.mu.Unlock()
+
+	err := pl.logistic.HandleUnicorn(u)
+
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	pl.held = nil
+	switch {
+	case errors.Is(err, storage.ErrFull):
+		pl.held = u
+	case err != nil:
+		pl.dropped++
+	}
+}
+
+// release returns the unicorn held by a stopped line, if any, so that it is not lost.
+func (pl *productionLine) release() *unicorn.Unicorn {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	u := pl.held
+	pl.held = nil
+	return u
+}
+
+// schedule the production of the next unicorn, unless the line is paused.
+// The timer must be stopped or expired and drained.
+func (pl *productionLine) schedule(timer *time.Timer) {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	if !pl.paused {
+		timer.Reset(pl.rate)
+	}
+}
+
+// stopTimer stops a timer, draining its channel if it has expired.
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
+
+// Rate returns the period in which the line produces a unicorn.
+func (pl *productionLine) Rate() time.Duration {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	return pl.rate
+}
+
+// SetRate changes the period in which the line produces a unicorn.
+// It takes effect immediately, restarting the production of the next unicorn.
+func (pl *productionLine) SetRate(rate time.Duration) error {
+	if rate <= 0 {
+		return unicorn.ErrInvalidRate
+	}
+
+	pl.mu.Lock()
+	pl.rate = rate
+	pl.mu.Unlock()
+
+	pl.notify()
+	return nil
+}
+
+// Pause stops the line from producing unicorns, until resumed.
+func (pl *productionLine) Pause() {
+	pl.mu.Lock()
+	pl.paused = true
+	pl.mu.Unlock()
+
+	pl.notify()
+}
+
+// Resume restarts the production of a paused line.
+func (pl *productionLine) Resume() {
+	pl.mu.Lock()
+	pl.paused = false
+	pl.mu.Unlock()
+
+	pl.notify()
+}
+
+// notify the running line of a change.
+func (pl *productionLine) notify() {
+	select {
+	case pl.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Stats returns the line statistics.
+func (pl *productionLine) Stats() unicorn.LineStats {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	return unicorn.LineStats{
+		ID:       pl.id,
+		Paused:   pl.paused,
+		Rate:     pl.rate,
+		Produced: pl.produced,
+		Dropped:  pl.dropped,
+		Blocked:  pl.held != nil,
+	}
+}
+
+// plant runs a pool of production lines, feeding the same logistics center.
+type plant struct {
+	logistics *logisticsCenter
+	factory   factory.Factory // of the lines added without a factory
+
+	mu     sync.RWMutex
+	lines  map[int]*productionLine
+	stops  map[int]func() // of the running lines, returning once the line has stopped
+	nextID int
+
+	ctx context.Context // of the running plant. nil if not running.
+	wg  sync.WaitGroup  // of the running lines
+}
+
+var _ unicorn.Production = (*plant)(nil)
+
+// NewPlant creates a plant without production lines.
+// Lines added without a factory, such as at runtime, produce unicorns with factory.
+func NewPlant(logistics *logisticsCenter, factory factory.Factory) *plant {
+	return &plant{
+		logistics: logistics,
+		factory:   factory,
+		lines:     make(map[int]*productionLine),
+		stops:     make(map[int]func()),
+		nextID:    1,
+	}
+}
+
+// NewLine adds a production line to the plant, producing a unicorn at every rate
+// with the plant factory. If the plant is running, the line starts producing right away.
+func (p *plant) NewLine(rate time.Duration) (int, error) {
+	return p.AddLine(p.factory, rate)
+}
+
+// AddLine adds a production line to the plant, producing a unicorn at every rate.
+// If the plant is running, the line starts producing right away.
+func (p *plant) AddLine(factory factory.Factory, rate time.Duration) (int, error) {
+	line, err := NewProductionLine(factory, p.logistics, rate)
+	if err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	line.id = p.nextID
+	p.nextID++
+
+	p.lines[line.id] = line
+	if p.ctx != nil {
+		p.start(line)
+	}
+
+	return line.id, nil
+}
+
+// RemoveLine stops a production line and removes it from the plant.
+// The unicorn held by the line, waiting for room in storage, is given back to logistics.
+func (p *plant) RemoveLine(id int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	line, ok := p.lines[id]
+	if !ok {
+		return fmt.Errorf("%w: %d", unicorn.ErrLineNotFound, id)
+	}
+
+	if stop, ok := p.stops[id]; ok {
+		stop()
+		delete(p.stops, id)
+	}
+	delete(p.lines, id)
+
+	if u := line.release(); u != nil {
+		p.logistics.GiveBack([]*unicorn.Unicorn{u})
+	}
+
+	return nil
+}
+
+// SetRate changes the period in which a production line produces a unicorn.
+func (p *plant) SetRate(id int, rate time.Duration) error {
+	line, err := p.line(id)
+	if err != nil {
+		return err
+	}
+
+	return line.SetRate(rate)
+}
+
+// Lines returns the statistics of every production line, ordered by ID.
+func (p *plant) Lines() []unicorn.LineStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	stats := make([]unicorn.LineStats, 0, len(p.lines))
+	for _, line := range p.lines {
+		stats = append(stats, line.Stats())
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].ID < stats[j].ID
+	})
+
+	return stats
+}
+
+// Line returns the statistics of a production line.
+func (p *plant) Line(id int) (unicorn.LineStats, error) {
+	line, err := p.line(id)
+	if err != nil {
+		return unicorn.LineStats{}, err
+	}
+
+	return line.Stats(), nil
+}
+
+// Pause stops a production line from producing unicorns, until resumed.
+func (p *plant) Pause(id int) error {
+	line, err := p.line(id)
+	if err != nil {
+		return err
+	}
+
+	line.Pause()
+	return nil
+}
+
+// Resume restarts the production of a paused line.
+func (p *plant) Resume(id int) error {
+	line, err := p.line(id)
+	if err != nil {
+		return err
+	}
+
+	line.Resume()
+	return nil
+}
+
+// StartProduction runs all the production lines until ctx is done.
+// It returns once all lines have stopped.
+func (p *plant) StartProduction(ctx context.Context) {
+	p.mu.Lock()
+	p.ctx = ctx
+	for _, line := range p.lines {
+		p.start(line)
+	}
+	p.mu.Unlock()
+
+	<-ctx.Done()
+
+	p.mu.Lock()
+	p.ctx = nil
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+// start runs a production line. Must be called with the lock held.
+// The line stop function returns once the line has stopped producing.
+func (p *plant) start(line *productionLine) {
+	ctx, cancel := context.WithCancel(p.ctx)
+	done := make(chan struct{})
+
+	p.stops[line.id] = func() {
+		cancel()
+		<-done
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(done)
+		defer cancel()
+		line.StartProduction(ctx)
+	}()
+}
+
+// line returns a production line.
+func (p *plant) line(id int) (*productionLine, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	line, ok := p.lines[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", unicorn.ErrLineNotFound, id)
+	}
+
+	return line, nil
+}
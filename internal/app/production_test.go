@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"unicorn"
+	"unicorn/storage"
+	"unicorn/storage/lifo"
+)
+
+// waitFor polls cond until it holds, failing the test after a while.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPlantLines(t *testing.T) {
+	lc := NewLogisticsCenter(lifo.New())
+	p := newTestPlant(t, lc, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		p.StartProduction(ctx)
+		close(stopped)
+	}()
+
+	// added while running, the line starts producing right away.
+	id, err := p.NewLine(time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 2 {
+		t.Errorf("added line %d, want 2", id)
+	}
+
+	waitFor(t, "both lines to produce", func() bool {
+		lines := p.Lines()
+		return len(lines) == 2 && lines[0].Produced > 0 && lines[1].Produced > 0
+	})
+
+	if err := p.RemoveLine(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Line(1); !errors.Is(err, unicorn.ErrLineNotFound) {
+		t.Errorf("err = %v, want %v", err, unicorn.ErrLineNotFound)
+	}
+	if err := p.RemoveLine(1); !errors.Is(err, unicorn.ErrLineNotFound) {
+		t.Errorf("removing twice: err = %v, want %v", err, unicorn.ErrLineNotFound)
+	}
+
+	// the remaining line keeps producing, and IDs are not reused.
+	stats, err := p.Line(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the remaining line to produce", func() bool {
+		line, _ := p.Line(2)
+		return line.Produced > stats.Produced
+	})
+
+	if id, err := p.NewLine(time.Millisecond); err != nil || id != 3 {
+		t.Errorf("added line %d, %v, want 3", id, err)
+	}
+
+	if _, err := p.NewLine(0); !errors.Is(err, unicorn.ErrInvalidRate) {
+		t.Errorf("err = %v, want %v", err, unicorn.ErrInvalidRate)
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the plant did not stop")
+	}
+}
+
+func TestPlantRemoveBlockedLine(t *testing.T) {
+	store := lifo.New(storage.WithCapacity(1, storage.Backpressure))
+	lc := NewLogisticsCenter(store)
+	p := newTestPlant(t, lc, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.StartProduction(ctx)
+
+	waitFor(t, "the line to be blocked", func() bool {
+		line, _ := p.Line(1)
+		return line.Blocked
+	})
+
+	if err := p.Pause(1); err != nil {
+		t.Fatal(err)
+	}
+	store.Collect(1) // room for the held unicorn.
+
+	if err := p.RemoveLine(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// the unicorn held by the line is not lost.
+	if n := store.InStorage(); n != 1 {
+		t.Errorf("%d unicorns in storage, want 1", n)
+	}
+}
@@ -0,0 +1,26 @@
+package app
+
+import (
+	"time"
+	"unicorn"
+)
+
+// Recorder records the history of the produced unicorns.
+type Recorder interface {
+	// Produced records a new unicorn.
+	Produced(u *unicorn.Unicorn)
+
+	// Assigned records the order a unicorn went to. The order is empty when
+	// the unicorn is given back by its order, before going to another order or to stock.
+	Assigned(u *unicorn.Unicorn, order unicorn.OrderID)
+
+	// Delivered records when a unicorn was delivered to the client.
+	Delivered(u *unicorn.Unicorn, at time.Time)
+}
+
+// nopRecorder does not record anything.
+type nopRecorder struct{}
+
+func (nopRecorder) Produced(*unicorn.Unicorn)                  {}
+func (nopRecorder) Assigned(*unicorn.Unicorn, unicorn.OrderID) {}
+func (nopRecorder) Delivered(*unicorn.Unicorn, time.Time)      {}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+	"unicorn"
+	"unicorn/pkg/jsonlog"
+)
+
+// OrderSnapshot is the persisted state of a pending order.
+type OrderSnapshot struct {
+	ID           unicorn.OrderID          `json:"id"`
+	Callback     string                   `json:"callback,omitempty"`
+	TTL          time.Duration            `json:"ttl,omitempty"`
+	Priority     unicorn.Priority         `json:"priority"`
+	CreatedAt    time.Time                `json:"createdAt"`
+	Capabilities unicorn.CapabilityFilter `json:"capabilities"`
+	Spec         *unicorn.Spec            `json:"spec,omitempty"`
+	Amount       int                      `json:"amount"`
+	Produced     int                      `json:"produced"`
+	Sent         int                      `json:"sent"`
+	Ready        []*unicorn.Unicorn       `json:"ready,omitempty"`
+}
+
+// OrderRepository persists pending orders across restarts.
+type OrderRepository interface {
+	// Save persists the pending orders.
+	// The snapshots are ordered by the position of the orders in the logistics queue.
+	Save(orders []OrderSnapshot) error
+
+	// Load returns the last saved pending orders, in the order they were saved.
+	Load() ([]OrderSnapshot, error)
+}
+
+type fileRepository struct {
+	path string
+}
+
+// NewFileRepository creates an order repository that snapshots the orders to a JSON file at path.
+func NewFileRepository(path string) *fileRepository {
+	return &fileRepository{
+		path: path,
+	}
+}
+
+var _ OrderRepository = (*fileRepository)(nil)
+
+// Save atomically replaces the snapshot file with the given orders.
+func (r *fileRepository) Save(orders []OrderSnapshot) error {
+	return jsonlog.WriteFile(r.path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(orders)
+	})
+}
+
+// Load reads the orders from the snapshot file. A missing file holds no orders.
+func (r *fileRepository) Load() ([]OrderSnapshot, error) {
+	f, err := os.Open(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var orders []OrderSnapshot
+	if err := json.NewDecoder(bufio.NewReader(f)).Decode(&orders); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
@@ -1,47 +1,204 @@
 package app
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"sync"
+	"time"
 	"unicorn"
+	"unicorn/factory"
 )
 
-var ErrInvalidOrder = errors.New("invalid production order")
+var (
+	ErrInvalidOrder        = fmt.Errorf("invalid production order: %w", unicorn.ErrOrderNotFound)
+	ErrExpiredOrder        = fmt.Errorf("expired production order: %w", unicorn.ErrOrderExpired)
+	ErrCustomBuildDisabled = fmt.Errorf("custom-built unicorns are disabled: %w", unicorn.ErrInvalidSpec)
+	ErrCustomBuildFiltered = fmt.Errorf("custom-built unicorns can not be filtered: %w", unicorn.ErrInvalidSpec)
+)
+
+// How long expired orders are remembered, to tell them apart from unknown orders.
+const expiredRetention = 24 * time.Hour
 
 type service struct {
 	mu sync.RWMutex
 
 	logistics *logisticsCenter
 
+	// to custom-build unicorns. custom-built orders are disabled if nil.
+	builds *buildLine
+
+	// to validate the capability filters of the orders against the unicorns produced.
+	// filters are only checked for consistency if nil.
+	catalog factory.Catalog
+
 	// to keep track of pending orders
 	orders map[unicorn.OrderID]*order
+
+	// to notify order callbacks. callbacks are disabled if nil.
+	webhooks *webhooks
+
+	// to expire orders that are not polled. orders do not expire if zero.
+	ttl     time.Duration
+	expired map[unicorn.OrderID]time.Time // when orders have expired
+
+	// to generate order IDs
+	ids IDGenerator
+}
+
+// Option is function used to customize the service.
+type Option func(*service)
+
+// WithWebhooks enables order callbacks, delivered by the webhook sender.
+func WithWebhooks(wh *webhooks) Option {
+	return func(s *service) {
+		s.webhooks = wh
+	}
+}
+
+// WithBuildLine enables custom-built orders, built by the build line.
+func WithBuildLine(bl *buildLine) Option {
+	return func(s *service) {
+		s.builds = bl
+	}
+}
+
+// WithCatalog rejects the orders filtering capabilities that no produced unicorn
+// can match, as the unicorns they wait for would never be produced.
+func WithCatalog(catalog factory.Catalog) Option {
+	return func(s *service) {
+		s.catalog = catalog
+	}
+}
+
+// WithOrderTTL sets the default time orders are kept without being polled, before expiring.
+// Expired orders are only removed while reaping orders.
+func WithOrderTTL(ttl time.Duration) Option {
+	return func(s *service) {
+		s.ttl = ttl
+	}
+}
+
+// WithOrderIDs sets the generator of order IDs.
+// By default, order IDs are random alphanumeric strings, OrderIDLength characters long.
+// To reproduce a run, give the generator a seeded source of random bytes.
+func WithOrderIDs(gen IDGenerator) Option {
+	return func(s *service) {
+		s.ids = gen
+	}
 }
 
 // New creates a new unicorn service app.
-func New(center *logisticsCenter) *service {
-	return &service{
+func New(center *logisticsCenter, options ...Option) *service {
+	s := &service{
 		logistics: center,
 		orders:    make(map[unicorn.OrderID]*order),
+		expired:   make(map[unicorn.OrderID]time.Time),
+	}
+
+	for _, opt := range options {
+		if opt != nil {
+			opt(s)
+		}
+	}
+
+	if s.ids == nil {
+		s.ids = NewRandomIDs(OrderIDLength, nil)
 	}
+
+	if s.webhooks != nil {
+		s.webhooks.delivered = s.delivered
+		s.webhooks.giveBack = center.GiveBack
+		center.OnCompleted(s.webhooks.Notify)
+
+		if s.builds != nil {
+			s.builds.OnCompleted(s.webhooks.Notify)
+		}
+	}
+
+	return s
 }
 
 var _ unicorn.Service = (*service)(nil)
 
 // OrderUnicorns initiates a new unicorn production request.
 // If no sufficient unicorn are available, it returns a request ID for consequent pooling.
-func (s *service) OrderUnicorns(amount int) (unicorn.OrderID, error) {
+func (s *service) OrderUnicorns(amount int, options ...unicorn.OrderOption) (unicorn.OrderID, error) {
 	if amount <= 0 {
 		return "", fmt.Errorf("invalid unicorn amount of %d", amount)
 	}
 
+	opts := unicorn.OrderOptions{
+		TTL: s.ttl,
+	}
+	for _, opt := range options {
+		if opt != nil {
+			opt(&opts)
+		}
+	}
+
+	if opts.TTL < 0 {
+		return "", fmt.Errorf("invalid order ttl of %v", opts.TTL)
+	}
+
+	if opts.Priority < unicorn.PriorityLow || opts.Priority > unicorn.PriorityHigh {
+		return "", unicorn.ErrInvalidPriority
+	}
+
+	if err := opts.Capabilities.Validate(); err != nil {
+		return "", err
+	}
+
+	if s.catalog != nil && !opts.Capabilities.Empty() {
+		if err := s.catalog.ValidateFilter(opts.Capabilities); err != nil {
+			return "", err
+		}
+	}
+
+	if opts.Spec != nil {
+		if s.builds == nil {
+			return "", ErrCustomBuildDisabled
+		}
+
+		if !opts.Capabilities.Empty() {
+			return "", ErrCustomBuildFiltered
+		}
+
+		if err := s.builds.Validate(*opts.Spec); err != nil {
+			return "", err
+		}
+	}
+
+	if opts.CallbackURL != "" {
+		if s.webhooks == nil {
+			return "", ErrCallbacksDisabled
+		}
+
+		if err := s.webhooks.validate(opts.CallbackURL); err != nil {
+			return "", err
+		}
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	order := NewOrder(uint(amount))
+	id, err := s.newOrderID()
+	if err != nil {
+		return "", err
+	}
+
+	order := NewOrder(id, uint(amount))
+	order.callback = opts.CallbackURL
+	order.ttl = opts.TTL
+	order.priority = opts.Priority
+	order.filter = opts.Capabilities
+	order.spec = opts.Spec
 
 	s.orders[order.ID] = order
-	s.logistics.AddOrder(order)
+	if order.CustomBuilt() {
+		s.builds.AddOrder(order)
+	} else {
+		s.logistics.AddOrder(order)
+	}
 
 	return order.ID, nil
 }
@@ -51,14 +208,19 @@ func (s *service) Pool(id unicorn.OrderID) ([]*unicorn.Unicorn, int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	order, ok := s.orders[id]
-	if !ok {
-		return nil, 0, ErrInvalidOrder
+	order, err := s.lookup(id)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	unicorns := order.Collect()
 	pending := order.PendingProduction()
 
+	now := time.Now()
+	for _, u := range unicorns {
+		s.logistics.recorder.Delivered(u, now)
+	}
+
 	if order.IsFulfilled() {
 		delete(s.orders, order.ID)
 	}
@@ -66,6 +228,154 @@ func (s *service) Pool(id unicorn.OrderID) ([]*unicorn.Unicorn, int, error) {
 	return unicorns, pending, nil
 }
 
+// CancelOrder cancels a pending order.
+// Its produced unicorns that were not collected go to the other pending orders
+// accepting them, as new production, or else back to stock.
+func (s *service) CancelOrder(id unicorn.OrderID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, err := s.lookup(id)
+	if err != nil {
+		return err
+	}
+
+	delete(s.orders, id)
+	s.cancel(order)
+
+	return nil
+}
+
+// cancel removes an order from production.
+func (s *service) cancel(order *order) {
+	if order.CustomBuilt() && s.builds != nil {
+		s.builds.CancelOrder(order)
+		return
+	}
+
+	s.logistics.CancelOrder(order)
+}
+
+// Status returns the progress of an order, without collecting its unicorns.
+func (s *service) Status(id unicorn.OrderID) (unicorn.OrderStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	order, err := s.lookup(id)
+	if err != nil {
+		return unicorn.OrderStatus{}, err
+	}
+
+	return order.Status(), nil
+}
+
+// delivered records the unicorns shipped by the order callback,
+// and removes the order once it has been fulfilled.
+func (s *service) delivered(order *order, unicorns []*unicorn.Unicorn) {
+	now := time.Now()
+	for _, u := range unicorns {
+		s.logistics.recorder.Delivered(u, now)
+	}
+
+	s.forget(order)
+}
+
+// forget removes an order once it has been fulfilled.
+func (s *service) forget(order *order) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if order.IsFulfilled() {
+		delete(s.orders, order.ID)
+	}
+}
+
+// Wait blocks until the order has unicorns ready to be collected,
+// its production has completed or ctx is done.
+func (s *service) Wait(ctx context.Context, id unicorn.OrderID) error {
+	s.mu.RLock()
+	order, err := s.lookup(id)
+	s.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	return order.Wait(ctx)
+}
+
+// lookup finds a pending order and marks it as polled.
+// Must be called with the lock held.
+func (s *service) lookup(id unicorn.OrderID) (*order, error) {
+	order, ok := s.orders[id]
+	if !ok {
+		if _, ok := s.expired[id]; ok {
+			return nil, ErrExpiredOrder
+		}
+		return nil, ErrInvalidOrder
+	}
+
+	order.Touch()
+	return order, nil
+}
+
+// newOrderID generates an order ID that was not given to a pending or a recently expired order.
+// Must be called with the lock held.
+func (s *service) newOrderID() (unicorn.OrderID, error) {
+	for attempt := 0; attempt < maxOrderIDAttempts; attempt++ {
+		id, err := s.ids.NewID()
+		if err != nil {
+			return "", fmt.Errorf("generating order ID: %w", err)
+		}
+
+		_, pending := s.orders[id]
+		_, expired := s.expired[id]
+		if !pending && !expired {
+			return id, nil
+		}
+	}
+
+	return "", ErrOrderIDCollision
+}
+
+// ReapOrders expires the orders that were not polled within their TTL at every interval,
+// until ctx is done. The produced unicorns of expired orders go to the other pending orders, or back to stock.
+func (s *service) ReapOrders(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.reap(now)
+		}
+	}
+}
+
+// reap expires the orders that were not polled within their TTL.
+func (s *service) reap(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, order := range s.orders {
+		if !order.Expired(now) {
+			continue
+		}
+
+		delete(s.orders, id)
+		s.cancel(order)
+		s.expired[id] = now
+	}
+
+	for id, at := range s.expired {
+		if now.Sub(at) > expiredRetention {
+			delete(s.expired, id)
+		}
+	}
+}
+
 // Validate checks if an ID has an orden in the process.
 func (s *service) Validate(id unicorn.OrderID) bool {
 	s.mu.RLock()
@@ -74,3 +384,68 @@ func (s *service) Validate(id unicorn.OrderID) bool {
 	_, ok := s.orders[id]
 	return ok
 }
+
+// SaveOrders persists the pending orders to the repository.
+func (s *service) SaveOrders(repo OrderRepository) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snaps := make([]OrderSnapshot, 0, len(s.orders))
+	saved := make(map[unicorn.OrderID]struct{}, len(s.orders))
+
+	// orders still in production keep their position in the logistics and build queues.
+	pending := s.logistics.PendingOrders()
+	if s.builds != nil {
+		pending = append(pending, s.builds.PendingOrders()...)
+	}
+
+	for _, order := range pending {
+		if _, ok := s.orders[order.ID]; !ok {
+			continue
+		}
+
+		snaps = append(snaps, order.Snapshot())
+		saved[order.ID] = struct{}{}
+	}
+
+	// orders already produced are only waiting to be collected.
+	for id, order := range s.orders {
+		if _, ok := saved[id]; !ok {
+			snaps = append(snaps, order.Snapshot())
+		}
+	}
+
+	return repo.Save(snaps)
+}
+
+// RestoreOrders loads the pending orders from the repository.
+// It must be called before starting the production.
+func (s *service) RestoreOrders(repo OrderRepository) (int, error) {
+	snaps, err := repo.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, snap := range snaps {
+		order := restoreOrder(snap)
+
+		if order.CustomBuilt() && s.builds == nil && !order.ProductionHasCompleted() {
+			return 0, fmt.Errorf("restoring order %s: %w", order.ID, ErrCustomBuildDisabled)
+		}
+
+		s.orders[order.ID] = order
+		switch {
+		case !order.ProductionHasCompleted() && order.CustomBuilt():
+			s.builds.AddOrder(order)
+		case !order.ProductionHasCompleted():
+			s.logistics.RestoreOrder(order)
+		case s.webhooks != nil:
+			s.webhooks.Notify(order)
+		}
+	}
+
+	return len(snaps), nil
+}
@@ -0,0 +1,273 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+	"unicorn"
+	"unicorn/pkg/queue"
+)
+
+// SignatureHeader is the name of the HTTP Header which contains the webhook body HMAC-SHA256 signature.
+// Exported so that it can be changed by developers.
+var SignatureHeader = "X-Unicorn-Signature"
+
+var (
+	ErrCallbacksDisabled = errors.New("order callbacks are not enabled")
+	ErrPrivateCallback   = errors.New("callback address is not public")
+)
+
+const (
+	defaultWebhookTimeout    = 10 * time.Second
+	defaultWebhookMaxBackoff = time.Minute
+)
+
+// WebhookPayload is the body posted to an order callback URL once its production has completed.
+type WebhookPayload struct {
+	OrderID  unicorn.OrderID    `json:"orderId"`
+	Unicorns []*unicorn.Unicorn `json:"unicorns"`
+}
+
+type webhooks struct {
+	client     *http.Client
+	secret     []byte        // to sign the webhook bodies
+	retries    int           // number of retries after a failed delivery
+	backoff    time.Duration // to wait before the first retry. doubled on each retry.
+	maxBackoff time.Duration // to wait between retries
+
+	// allowPrivate lets callbacks reach loopback and private addresses. only for tests.
+	allowPrivate bool
+
+	mu      sync.Mutex
+	pending *queue.Queue[*order] // completed orders waiting for delivery
+	signal  chan struct{}        // signals new pending orders
+
+	delivered func(*order, []*unicorn.Unicorn) // called when order unicorns have been shipped by its callback
+	giveBack  func([]*unicorn.Unicorn) int     // takes the unicorns of orders cancelled during their delivery
+}
+
+// NewWebhooks creates a webhook sender, which notifies the order callbacks once their production has completed.
+// Failed deliveries are retried with an exponential backoff.
+//
+// Callbacks only reach public addresses, and redirects are not followed,
+// so that clients cannot make the server post to its internal network.
+func NewWebhooks(secret string, retries int, backoff time.Duration) *webhooks {
+	wh := &webhooks{
+		secret:     []byte(secret),
+		retries:    retries,
+		backoff:    backoff,
+		maxBackoff: defaultWebhookMaxBackoff,
+		pending:    queue.New[*order](),
+		signal:     make(chan struct{}, 1),
+	}
+
+	// the addresses are checked once resolved, since a public host name can resolve to a private address.
+	dialer := &net.Dialer{
+		Timeout:   defaultWebhookTimeout,
+		KeepAlive: 30 * time.Second,
+		Control:   wh.control,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // a proxy would connect to the callback without the address check.
+	transport.DialContext = dialer.DialContext
+
+	wh.client = &http.Client{
+		Transport: transport,
+		Timeout:   defaultWebhookTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return wh
+}
+
+// Notify queues the callback delivery of a completed order.
+// Orders without callback are ignored. Orders do not expire until delivered, or the delivery failed.
+func (wh *webhooks) Notify(order *order) {
+	if order.callback == "" {
+		return
+	}
+
+	order.SetDelivering(true)
+
+	wh.mu.Lock()
+	wh.pending.Enqueue(order)
+	wh.mu.Unlock()
+
+	select {
+	case wh.signal <- struct{}{}:
+	default:
+	}
+}
+
+// StartDelivery delivers the queued callbacks until ctx is done.
+// It returns once all ongoing deliveries have returned.
+func (wh *webhooks) StartDelivery(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-wh.signal:
+			wh.mu.Lock()
+			orders := wh.pending.DequeueAll()
+			wh.mu.Unlock()
+
+			for _, o := range orders {
+				wg.Add(1)
+				go func(o *order) {
+					defer wg.Done()
+					wh.deliver(ctx, o)
+				}(o)
+			}
+		}
+	}
+}
+
+// deliver ships the order unicorns to its callback.
+// If the delivery fails, the unicorns are returned to the order so they can be pooled,
+// or given back if the order was cancelled in the meantime.
+func (wh *webhooks) deliver(ctx context.Context, order *order) {
+	defer order.SetDelivering(false)
+
+	if order.Cancelled() {
+		return
+	}
+
+	unicorns := order.Collect()
+
+	body, err := json.Marshal(&WebhookPayload{
+		OrderID:  order.ID,
+		Unicorns: unicorns,
+	})
+	if err != nil {
+		wh.undeliver(order, unicorns)
+		return
+	}
+
+	backoff := wh.backoff
+	for attempt := 0; ; attempt++ {
+		if err := wh.post(ctx, order.callback, body); err == nil {
+			break
+		}
+
+		if attempt == wh.retries {
+			wh.undeliver(order, unicorns)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			wh.undeliver(order, unicorns)
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > wh.maxBackoff {
+			backoff = wh.maxBackoff
+		}
+	}
+
+	if wh.delivered != nil {
+		wh.delivered(order, unicorns)
+	}
+}
+
+// undeliver returns the unicorns that could not be shipped to their order,
+// giving the client a chance to poll them, or gives them back if the order was cancelled.
+func (wh *webhooks) undeliver(order *order, unicorns []*unicorn.Unicorn) {
+	if order.Return(unicorns) {
+		order.Touch()
+		return
+	}
+
+	if wh.giveBack != nil {
+		wh.giveBack(unicorns)
+	}
+}
+
+// post sends a signed webhook body to url.
+func (wh *webhooks) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if len(wh.secret) != 0 {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(wh.secret, body))
+	}
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("callback replied with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 signature of body.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validate checks if a callback is an absolute HTTP URL, not addressing a private IP.
+// Host names are checked when connecting, once resolved.
+func (wh *webhooks) validate(callback string) error {
+	u, err := url.Parse(callback)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w %q", unicorn.ErrInvalidCallback, callback)
+	}
+
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !wh.allowPrivate && !public(ip) {
+		return fmt.Errorf("%w %q: %v", unicorn.ErrInvalidCallback, callback, ErrPrivateCallback)
+	}
+
+	return nil
+}
+
+// control refuses the callback connections to addresses which are not public.
+func (wh *webhooks) control(network, address string, _ syscall.RawConn) error {
+	if wh.allowPrivate {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !public(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateCallback, address)
+	}
+
+	return nil
+}
+
+// public reports whether ip is a public unicast address,
+// excluding the loopback, private, link-local (such as cloud metadata services), multicast and unspecified ones.
+func public(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
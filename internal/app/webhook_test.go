@@ -0,0 +1,281 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicorn"
+	"unicorn/storage/lifo"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	const secret = "s3cr3t"
+
+	var (
+		mu       sync.Mutex
+		attempts int
+	)
+	received := make(chan WebhookPayload, 1)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading callback body: %v", err)
+			return
+		}
+
+		if got, want := r.Header.Get(SignatureHeader), "sha256="+Sign([]byte(secret), body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+
+		// fail the first delivery, to be retried
+		mu.Lock()
+		attempts++
+		first := attempts == 1
+		mu.Unlock()
+
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("decoding callback body: %v", err)
+		}
+		received <- payload
+	}))
+	defer receiver.Close()
+
+	lc := NewLogisticsCenter(lifo.New())
+	wh := NewWebhooks(secret, 2, time.Millisecond)
+	wh.allowPrivate = true // the receiver listens on loopback.
+	svc := New(lc, WithWebhooks(wh))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wh.StartDelivery(ctx)
+
+	id, err := svc.OrderUnicorns(2, unicorn.WithCallback(receiver.URL))
+	if err != nil {
+		t.Fatalf("ordering unicorns: %v", err)
+	}
+
+	for _, name := range []string{"first", "second"} {
+		if err := lc.HandleUnicorn(&unicorn.Unicorn{ID: name, Name: name}); err != nil {
+			t.Fatalf("handling unicorn: %v", err)
+		}
+	}
+
+	select {
+	case payload := <-received:
+		if payload.OrderID != id {
+			t.Errorf("order ID = %q, want %q", payload.OrderID, id)
+		}
+		if len(payload.Unicorns) != 2 {
+			t.Errorf("delivered %d unicorns, want 2", len(payload.Unicorns))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback was not delivered")
+	}
+
+	mu.Lock()
+	if attempts != 2 {
+		t.Errorf("delivered in %d attempts, want 2", attempts)
+	}
+	mu.Unlock()
+}
+
+func TestInvalidCallback(t *testing.T) {
+	svc := New(NewLogisticsCenter(lifo.New()), WithWebhooks(NewWebhooks("", 0, time.Millisecond)))
+
+	for _, callback := range []string{"example.com/unicorns", "ftp://example.com", "http://"} {
+		if _, err := svc.OrderUnicorns(1, unicorn.WithCallback(callback)); !errors.Is(err, unicorn.ErrInvalidCallback) {
+			t.Errorf("ordering with callback %q: err = %v, want %v", callback, err, unicorn.ErrInvalidCallback)
+		}
+	}
+}
+
+func TestCallbackOrderDoesNotExpireBeforeDelivery(t *testing.T) {
+	delivered := make(chan struct{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer receiver.Close()
+
+	lc := NewLogisticsCenter(lifo.New())
+	wh := NewWebhooks("", 0, time.Millisecond)
+	wh.allowPrivate = true // the receiver listens on loopback.
+	svc := New(lc, WithWebhooks(wh))
+
+	id, err := svc.OrderUnicorns(1, unicorn.WithCallback(receiver.URL), unicorn.WithTTL(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the production takes longer than the TTL, and the delivery is not started yet.
+	if err := lc.HandleUnicorn(&unicorn.Unicorn{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	svc.reap(time.Now().Add(time.Hour))
+
+	if !svc.Validate(id) {
+		t.Fatal("the order expired while queued for delivery")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wh.StartDelivery(ctx)
+
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback was not delivered")
+	}
+}
+
+func TestCancelledDuringDelivery(t *testing.T) {
+	var svc *service
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload WebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decoding callback body: %v", err)
+		}
+
+		// the client cancels the order while its delivery fails.
+		if err := svc.CancelOrder(payload.OrderID); err != nil {
+			t.Errorf("cancelling order: %v", err)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	store := lifo.New()
+	lc := NewLogisticsCenter(store)
+	wh := NewWebhooks("", 0, time.Millisecond)
+	wh.allowPrivate = true // the receiver listens on loopback.
+	svc = New(lc, WithWebhooks(wh))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wh.StartDelivery(ctx)
+
+	if _, err := svc.OrderUnicorns(1, unicorn.WithCallback(receiver.URL)); err != nil {
+		t.Fatal(err)
+	}
+	if err := lc.HandleUnicorn(&unicorn.Unicorn{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the undelivered unicorn goes back to stock, instead of the cancelled order.
+	deadline := time.Now().Add(5 * time.Second)
+	for store.InStorage() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("the unicorn of the cancelled order was lost")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPrivateCallback(t *testing.T) {
+	svc := New(NewLogisticsCenter(lifo.New()), WithWebhooks(NewWebhooks("", 0, time.Millisecond)))
+
+	for _, callback := range []string{
+		"http://127.0.0.1:8000/unicorns",
+		"http://[::1]/unicorns",
+		"http://10.0.0.1/unicorns",
+		"http://192.168.1.1/unicorns",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0/unicorns",
+	} {
+		if _, err := svc.OrderUnicorns(1, unicorn.WithCallback(callback)); !errors.Is(err, unicorn.ErrInvalidCallback) {
+			t.Errorf("ordering with callback %q: err = %v, want %v", callback, err, unicorn.ErrInvalidCallback)
+		}
+	}
+
+	if _, err := svc.OrderUnicorns(1, unicorn.WithCallback("https://203.0.113.10/unicorns")); err != nil {
+		t.Errorf("ordering with a public callback: %v", err)
+	}
+}
+
+func TestPrivateCallbackResolved(t *testing.T) {
+	hit := make(chan struct{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit <- struct{}{}
+	}))
+	defer receiver.Close()
+
+	lc := NewLogisticsCenter(lifo.New())
+	wh := NewWebhooks("", 0, time.Millisecond)
+	svc := New(lc, WithWebhooks(wh))
+
+	// the host name passes the validation, but resolves to a loopback address.
+	callback := strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1)
+
+	id, err := svc.OrderUnicorns(1, unicorn.WithCallback(callback))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lc.HandleUnicorn(&unicorn.Unicorn{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	o := svc.orders[id]
+	wh.deliver(context.Background(), o)
+
+	select {
+	case <-hit:
+		t.Error("the callback reached a loopback address")
+	default:
+	}
+
+	if status := o.Status(); status.Ready != 1 || status.Delivered != 0 {
+		t.Errorf("status %+v, want the unicorn ready", status)
+	}
+}
+
+func TestCallbackRedirect(t *testing.T) {
+	hit := make(chan struct{}, 1)
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit <- struct{}{}
+	}))
+	defer internal.Close()
+
+	receiver := httptest.NewServer(http.RedirectHandler(internal.URL, http.StatusTemporaryRedirect))
+	defer receiver.Close()
+
+	lc := NewLogisticsCenter(lifo.New())
+	wh := NewWebhooks("", 0, time.Millisecond)
+	wh.allowPrivate = true // the receiver listens on loopback.
+	svc := New(lc, WithWebhooks(wh))
+
+	id, err := svc.OrderUnicorns(1, unicorn.WithCallback(receiver.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lc.HandleUnicorn(&unicorn.Unicorn{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	o := svc.orders[id]
+	wh.deliver(context.Background(), o)
+
+	select {
+	case <-hit:
+		t.Error("the callback redirect was followed")
+	default:
+	}
+
+	// the redirect is a failed delivery, leaving the unicorn to be polled.
+	if status := o.Status(); status.Ready != 1 || status.Delivered != 0 {
+		t.Errorf("status %+v, want the unicorn ready", status)
+	}
+}
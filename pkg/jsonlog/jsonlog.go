@@ -0,0 +1,96 @@
+// Package jsonlog provides the files shared by the persistent stores:
+// append-only logs of JSON records, one per line, and files replaced atomically.
+package jsonlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Replay decodes the records of the log at path, one per line, and passes them to apply in order.
+// A missing log is considered empty. A truncated last record, left by a crash
+// in the middle of a write, is ignored.
+// Errors of apply are reported with the line of the record.
+func Replay[T any](path string, apply func(record T) error) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var broken error // decoding error of the last seen record
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if broken != nil {
+			return broken
+		}
+
+		var record T
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			broken = fmt.Errorf("%s:%d: corrupted record: %w", path, line, err)
+			continue
+		}
+
+		if err := apply(record); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Rewrite atomically replaces the log at path with the records, one per line.
+func Rewrite[T any](path string, records []T) error {
+	return WriteFile(path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		for i := range records {
+			if err := enc.Encode(&records[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// WriteFile atomically replaces the file at path with what write writes.
+// The content goes to a temporary file in the same directory, synced, then renamed over path,
+// so that a crash leaves either the previous or the new file.
+func WriteFile(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+
+	if err := write(w); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
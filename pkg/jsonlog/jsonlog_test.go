@@ -0,0 +1,102 @@
+package jsonlog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type record struct {
+	N int `json:"n"`
+}
+
+func TestReplay(t *testing.T) {
+	errOdd := errors.New("odd record")
+
+	tests := []struct {
+		name   string
+		log    string
+		want   []int
+		errMsg string
+	}{
+		{"complete", `{"n":1}` + "\n" + `{"n":2}` + "\n", []int{1, 2}, ""},
+		{"truncated last record", `{"n":1}` + "\n" + `{"n":`, []int{1}, ""},
+		{"corrupted record", `{"n":1}` + "\n" + `{"n":` + "\n" + `{"n":2}` + "\n", nil, "log:2: corrupted record"},
+		{"rejected record", `{"n":2}` + "\n" + `{"n":3}` + "\n", nil, "log:2: odd record"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "log")
+			if err := os.WriteFile(path, []byte(tt.log), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []int
+			err := Replay(path, func(r record) error {
+				if r.N == 3 {
+					return errOdd
+				}
+				got = append(got, r.N)
+				return nil
+			})
+
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Fatalf("err = %v, want %q", err, tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("replayed %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("replayed %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayMissing(t *testing.T) {
+	err := Replay(filepath.Join(t.TempDir(), "missing"), func(record) error {
+		t.Error("replayed a record of a missing log")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+
+	if err := os.WriteFile(path, []byte(`{"n":1}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Rewrite(path, []record{{N: 2}, {N: 3}}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), `{"n":2}`+"\n"+`{"n":3}`+"\n"; got != want {
+		t.Errorf("rewritten log %q, want %q", got, want)
+	}
+
+	// the temporary file is gone.
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files left in the directory, want 1", len(entries))
+	}
+}
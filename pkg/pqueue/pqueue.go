@@ -0,0 +1,182 @@
+// Package pqueue provides an implementation of a priority queue.
+// The priority queue is implemented using the container/heap standard library binary heap,
+// and serves items of equal priority in a First In First Out (FIFO) order.
+package pqueue
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// PriorityQueue is a priority queue, where items of equal priority are served First In First Out (FIFO).
+type PriorityQueue[T any] struct {
+	heap *entries[T]
+	seq  uint64 // insertion sequence, for the FIFO tie-breaking
+}
+
+// New returns an empty priority queue.
+// 'less' reports whether 'a' must be served before 'b'.
+func New[T any](less func(a, b T) bool) *PriorityQueue[T] {
+	return &PriorityQueue[T]{
+		heap: &entries[T]{
+			less: less,
+		},
+	}
+}
+
+// Len returns the number of items currently in the queue.
+func (pq *PriorityQueue[T]) Len() int {
+	return pq.heap.Len()
+}
+
+// Push inserts 'value' in the queue.
+func (pq *PriorityQueue[T]) Push(value T) {
+	heap.Push(pq.heap, entry[T]{value: value, seq: pq.seq})
+	pq.seq++
+}
+
+// Pop removes and returns the item with the highest priority.
+//
+// A panic occurs if the queue is Empty.
+func (pq *PriorityQueue[T]) Pop() T {
+	value, ok := pq.TryPop()
+	if !ok {
+		panic("pqueue: tried to pop from an empty queue")
+	}
+	return value
+}
+
+// TryPop tries to remove and return the item with the highest priority.
+//
+// If the queue is empty, then false is returned as the second return value.
+func (pq *PriorityQueue[T]) TryPop() (T, bool) {
+	if pq.Empty() {
+		var zero T
+		return zero, false
+	}
+
+	return heap.Pop(pq.heap).(entry[T]).value, true
+}
+
+// Peek returns the item with the highest priority, without removing it.
+//
+// If the queue is empty, then false is returned as the second return value.
+func (pq *PriorityQueue[T]) Peek() (T, bool) {
+	if pq.Empty() {
+		var zero T
+		return zero, false
+	}
+
+	return pq.heap.items[0].value, true
+}
+
+// RemoveFunc removes the first item found for which 'fn' returns true.
+//
+// It returns true if an item was removed.
+func (pq *PriorityQueue[T]) RemoveFunc(fn func(T) bool) bool {
+	for i, e := range pq.heap.items {
+		if fn(e.value) {
+			heap.Remove(pq.heap, i)
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractFunc removes and returns up to 'n' items for which 'fn' returns true,
+// in the order they would be served.
+func (pq *PriorityQueue[T]) ExtractFunc(n int, fn func(T) bool) []T {
+	sorted := make([]entry[T], len(pq.heap.items))
+	copy(sorted, pq.heap.items)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return pq.heap.entryLess(sorted[i], sorted[j])
+	})
+
+	var items []T
+	kept := pq.heap.items[:0]
+	for _, e := range sorted {
+		if len(items) < n && fn(e.value) {
+			items = append(items, e.value)
+			continue
+		}
+		kept = append(kept, e)
+	}
+
+	for i := len(kept); i < len(pq.heap.items); i++ {
+		pq.heap.items[i] = entry[T]{} // do not retain the values
+	}
+	pq.heap.items = kept // sorted, so still a heap.
+
+	return items
+}
+
+// Fix reorders the queue after the priority of its items has changed.
+func (pq *PriorityQueue[T]) Fix() {
+	heap.Init(pq.heap)
+}
+
+// Items returns all the items in the order they will be served, without removing them.
+func (pq *PriorityQueue[T]) Items() []T {
+	sorted := make([]entry[T], len(pq.heap.items))
+	copy(sorted, pq.heap.items)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return pq.heap.entryLess(sorted[i], sorted[j])
+	})
+
+	items := make([]T, len(sorted))
+	for i, e := range sorted {
+		items[i] = e.value
+	}
+	return items
+}
+
+// Each calls 'fn' on every item in the queue, in no particular order.
+func (pq *PriorityQueue[T]) Each(fn func(T)) {
+	for _, e := range pq.heap.items {
+		fn(e.value)
+	}
+}
+
+// Empty returns true if the queue is empty.
+func (pq *PriorityQueue[T]) Empty() bool {
+	return pq.heap.Len() == 0
+}
+
+type entry[T any] struct {
+	value T
+	seq   uint64
+}
+
+// entries implements heap.Interface.
+type entries[T any] struct {
+	items []entry[T]
+	less  func(a, b T) bool
+}
+
+func (h *entries[T]) entryLess(a, b entry[T]) bool {
+	if h.less(a.value, b.value) {
+		return true
+	}
+	if h.less(b.value, a.value) {
+		return false
+	}
+	return a.seq < b.seq
+}
+
+func (h *entries[T]) Len() int           { return len(h.items) }
+func (h *entries[T]) Less(i, j int) bool { return h.entryLess(h.items[i], h.items[j]) }
+func (h *entries[T]) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *entries[T]) Push(x any) {
+	h.items = append(h.items, x.(entry[T]))
+}
+
+func (h *entries[T]) Pop() any {
+	n := len(h.items)
+	e := h.items[n-1]
+	h.items[n-1] = entry[T]{} // do not retain the value
+	h.items = h.items[:n-1]
+	return e
+}
@@ -0,0 +1,105 @@
+package pqueue
+
+import (
+	"testing"
+)
+
+type item struct {
+	name     string
+	priority int
+}
+
+func newQueue(items ...item) *PriorityQueue[item] {
+	pq := New(func(a, b item) bool { return a.priority > b.priority })
+	for _, it := range items {
+		pq.Push(it)
+	}
+	return pq
+}
+
+func names(items []item) string {
+	var s string
+	for _, it := range items {
+		s += it.name
+	}
+	return s
+}
+
+func TestPopOrder(t *testing.T) {
+	pq := newQueue(item{"a", 0}, item{"b", 1}, item{"c", 0}, item{"d", 1}, item{"e", -1}, item{"f", 0})
+
+	var popped []item
+	for !pq.Empty() {
+		popped = append(popped, pq.Pop())
+	}
+
+	// by priority, then First In First Out.
+	if got, want := names(popped), "bdacfe"; got != want {
+		t.Errorf("popped %s, want %s", got, want)
+	}
+
+	if _, ok := pq.TryPop(); ok {
+		t.Error("popped from an empty queue")
+	}
+}
+
+func TestItems(t *testing.T) {
+	pq := newQueue(item{"a", 0}, item{"b", 1}, item{"c", 0})
+
+	if got, want := names(pq.Items()), "bac"; got != want {
+		t.Errorf("items %s, want %s", got, want)
+	}
+
+	if top, ok := pq.Peek(); !ok || top.name != "b" {
+		t.Errorf("peeked %v, want b", top)
+	}
+
+	if pq.Len() != 3 {
+		t.Errorf("len %d, want 3", pq.Len())
+	}
+}
+
+func TestExtractFunc(t *testing.T) {
+	pq := newQueue(item{"a", 0}, item{"b", 1}, item{"c", 0}, item{"d", 1}, item{"e", 0})
+
+	extracted := pq.ExtractFunc(2, func(it item) bool { return it.name != "b" })
+	if got, want := names(extracted), "da"; got != want {
+		t.Errorf("extracted %s, want %s", got, want)
+	}
+
+	if got, want := names(pq.Items()), "bce"; got != want {
+		t.Errorf("left %s, want %s", got, want)
+	}
+
+	// pushed after the extraction, still served after the items of equal priority.
+	pq.Push(item{"f", 0})
+	if got, want := pq.Pop().name+pq.Pop().name+pq.Pop().name+pq.Pop().name, "bcef"; got != want {
+		t.Errorf("popped %s, want %s", got, want)
+	}
+}
+
+func TestRemoveFuncAndFix(t *testing.T) {
+	a, b, c := &item{"a", 0}, &item{"b", 1}, &item{"c", 2}
+
+	pq := New(func(x, y *item) bool { return x.priority > y.priority })
+	pq.Push(a)
+	pq.Push(b)
+	pq.Push(c)
+
+	if !pq.RemoveFunc(func(it *item) bool { return it == b }) {
+		t.Fatal("b was not removed")
+	}
+	if pq.RemoveFunc(func(it *item) bool { return it == b }) {
+		t.Fatal("b was removed twice")
+	}
+
+	a.priority = 3
+	pq.Fix()
+
+	if got := pq.Pop(); got != a {
+		t.Errorf("popped %s, want a", got.name)
+	}
+	if got := pq.Pop(); got != c {
+		t.Errorf("popped %s, want c", got.name)
+	}
+}
@@ -60,6 +60,41 @@ func (q *Queue[T]) DequeueAll() []T {
 	return slice
 }
 
+// RemoveFunc removes the first item in the queue for which 'fn' returns true.
+//
+// It returns true if an item was removed.
+func (q *Queue[T]) RemoveFunc(fn func(T) bool) bool {
+	for e := q.list.Front(); e != nil; e = e.Next() {
+		if fn(e.Value.(T)) {
+			q.list.Remove(e)
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractFunc removes and returns up to 'n' items for which 'fn' returns true,
+// starting with the front.
+func (q *Queue[T]) ExtractFunc(n int, fn func(T) bool) []T {
+	var items []T
+	for e := q.list.Front(); e != nil && len(items) < n; {
+		next := e.Next()
+		if v := e.Value.(T); fn(v) {
+			q.list.Remove(e)
+			items = append(items, v)
+		}
+		e = next
+	}
+	return items
+}
+
+// Each calls 'fn' on every item in the queue, starting with the front.
+func (q *Queue[T]) Each(fn func(T)) {
+	for e := q.list.Front(); e != nil; e = e.Next() {
+		fn(e.Value.(T))
+	}
+}
+
 // Empty returns true if the queue is empty.
 func (q *Queue[T]) Empty() bool {
 	return q.list.Len() == 0
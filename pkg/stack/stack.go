@@ -31,6 +31,39 @@ func (s *Stack[T]) Pop() (t T) {
 	return v
 }
 
+// PopBottom removes the stack's bottom element and returns it. If the stack is
+// empty it returns the zero value.
+func (s *Stack[T]) PopBottom() (t T) {
+	if len(s.entries) == 0 {
+		return t
+	}
+	v := s.entries[0]
+	copy(s.entries, s.entries[1:])
+	s.entries[len(s.entries)-1] = t
+	s.entries = s.entries[:len(s.entries)-1]
+	return v
+}
+
+// At returns the element at position i, counting from the bottom of the stack.
+//
+// A panic occurs if i is out of range.
+func (s *Stack[T]) At(i int) T {
+	return s.entries[i]
+}
+
+// RemoveAt removes the element at position i, counting from the bottom of the
+// stack, and returns it.
+//
+// A panic occurs if i is out of range.
+func (s *Stack[T]) RemoveAt(i int) T {
+	var zero T
+	v := s.entries[i]
+	copy(s.entries[i:], s.entries[i+1:])
+	s.entries[len(s.entries)-1] = zero
+	s.entries = s.entries[:len(s.entries)-1]
+	return v
+}
+
 // Size returns the number of elements in the stack.
 func (s *Stack[T]) Size() int {
 	return len(s.entries)
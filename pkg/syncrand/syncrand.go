@@ -0,0 +1,54 @@
+// Package syncrand provides random number generators safe for concurrent use,
+// unlike the ones created with math/rand.New, without sharing the global source.
+package syncrand
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// source serializes the access to a random source.
+type source struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+// New returns a random number generator, safe for concurrent use, drawing from src.
+// src must not be used elsewhere afterwards.
+func New(src rand.Source) *rand.Rand {
+	return rand.New(&source{src: src})
+}
+
+// NewSeeded returns a random number generator, safe for concurrent use, seeded with seed.
+// Generators with the same seed generate the same sequence of numbers.
+func NewSeeded(seed int64) *rand.Rand {
+	return New(rand.NewSource(seed))
+}
+
+// NewRandom returns a random number generator, safe for concurrent use, seeded with the time.
+func NewRandom() *rand.Rand {
+	return NewSeeded(time.Now().UnixNano())
+}
+
+func (s *source) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *source) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if src, ok := s.src.(rand.Source64); ok {
+		return src.Uint64()
+	}
+	return uint64(s.src.Int63())>>31 | uint64(s.src.Int63())<<32
+}
+
+func (s *source) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
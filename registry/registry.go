@@ -0,0 +1,341 @@
+package registry
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unicorn"
+	"unicorn/pkg/jsonlog"
+)
+
+// Default period in which the log is synced to disk.
+const defaultSyncInterval = time.Second
+
+const (
+	opProduced  = "produced"
+	opAssigned  = "assigned"
+	opDelivered = "delivered"
+)
+
+// event is a single entry of the registry append-only log.
+type event struct {
+	Op      string          `json:"op"`
+	Record  *unicorn.Record `json:"record,omitempty"`
+	ID      string          `json:"id,omitempty"`
+	OrderID unicorn.OrderID `json:"orderId,omitempty"`
+	At      *time.Time      `json:"at,omitempty"`
+}
+
+type registry struct {
+	mu sync.RWMutex
+
+	records      map[string]*unicorn.Record
+	ids          []string            // of the unicorns, in the order they were produced
+	byName       map[string][]string // unicorn IDs by name
+	byCapability map[string][]string // unicorn IDs by capability
+
+	file *os.File      // log of the registry. not persisted if nil.
+	w    *bufio.Writer // buffering the events until the log is synced
+	err  error         // first error writing to the log. once set, the log is no longer written.
+
+	syncInterval time.Duration // period in which the log is synced to disk
+	stop         chan struct{} // stops syncing the log
+	stopped      chan struct{} // closed once the log is no longer synced in the background
+}
+
+// Option is function used to customize the registry.
+type Option func(*registry)
+
+// WithSyncInterval sets the period in which the events are synced to the log.
+// Events are written and synced in the background, so that recording a unicorn
+// does not wait for the disk. At most the events of one period are lost on a crash.
+func WithSyncInterval(interval time.Duration) Option {
+	return func(r *registry) {
+		if interval > 0 {
+			r.syncInterval = interval
+		}
+	}
+}
+
+// New creates an in-memory unicorn registry.
+func New() *registry {
+	return &registry{
+		records:      make(map[string]*unicorn.Record),
+		byName:       make(map[string][]string),
+		byCapability: make(map[string][]string),
+	}
+}
+
+// Open creates a unicorn registry persisted to an append-only log at path.
+// If the log already exists, it is replayed to restore the records and
+// compacted so that it holds a single entry per unicorn.
+// The registry must be closed to sync the last events to the log.
+func Open(path string, options ...Option) (*registry, error) {
+	r := New()
+	r.syncInterval = defaultSyncInterval
+
+	for _, opt := range options {
+		if opt != nil {
+			opt(r)
+		}
+	}
+
+	if err := r.replay(path); err != nil {
+		return nil, err
+	}
+
+	if err := r.compact(path); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	r.file = file
+	r.w = bufio.NewWriter(file)
+	r.stop = make(chan struct{})
+	r.stopped = make(chan struct{})
+
+	go r.syncLoop()
+
+	return r, nil
+}
+
+var _ unicorn.Registry = (*registry)(nil)
+
+// Produced records a new unicorn.
+func (r *registry) Produced(u *unicorn.Unicorn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record := &unicorn.Record{
+		ID:           u.ID,
+		Name:         u.Name,
+		Capabilities: u.Capabilities,
+		Rarity:       u.Rarity,
+		ProducedAt:   u.CreatedAt,
+	}
+
+	if r.add(record) {
+		r.append(event{Op: opProduced, Record: record})
+	}
+}
+
+// Assigned records the order a unicorn went to.
+func (r *registry) Assigned(u *unicorn.Unicorn, order unicorn.OrderID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if record, ok := r.records[u.ID]; ok {
+		record.OrderID = order
+		r.append(event{Op: opAssigned, ID: u.ID, OrderID: order})
+	}
+}
+
+// Delivered records when a unicorn was delivered to the client.
+func (r *registry) Delivered(u *unicorn.Unicorn, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if record, ok := r.records[u.ID]; ok {
+		record.DeliveredAt = &at
+		r.append(event{Op: opDelivered, ID: u.ID, At: &at})
+	}
+}
+
+// Unicorn returns the record of a unicorn by its ID.
+func (r *registry) Unicorn(id string) (unicorn.Record, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	record, ok := r.records[id]
+	if !ok {
+		return unicorn.Record{}, unicorn.ErrUnicornNotFound
+	}
+
+	return *record, nil
+}
+
+// Search returns the records matching the query, in the order the unicorns were produced.
+func (r *registry) Search(query unicorn.RegistryQuery) []unicorn.Record {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// narrow the search with the indexes
+	ids := r.ids
+	switch {
+	case query.Name != "":
+		ids = r.byName[query.Name]
+	case query.Capability != "":
+		ids = r.byCapability[query.Capability]
+	}
+
+	records := []unicorn.Record{}
+	for _, id := range ids {
+		if query.Limit > 0 && len(records) == query.Limit {
+			break
+		}
+
+		record := r.records[id]
+		if query.Name != "" && record.Name != query.Name {
+			continue
+		}
+		if query.Capability != "" && !hasCapability(record, query.Capability) {
+			continue
+		}
+
+		records = append(records, *record)
+	}
+
+	return records
+}
+
+// Err returns the first error that occurred while writing to the log, if any.
+func (r *registry) Err() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.err
+}
+
+// Close syncs the last events and closes the underlying log file, if any.
+// It returns the first error that occurred while writing to the log, if any.
+func (r *registry) Close() error {
+	if r.file == nil {
+		return r.Err()
+	}
+
+	close(r.stop)
+	<-r.stopped
+
+	r.sync()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.file.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+
+	return r.err
+}
+
+// syncLoop syncs the log at every interval, until stopped.
+func (r *registry) syncLoop() {
+	defer close(r.stopped)
+
+	ticker := time.NewTicker(r.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.sync()
+		}
+	}
+}
+
+// sync writes the buffered events to the log and syncs it to disk.
+// The disk is synced without the lock held, so that events keep being recorded meanwhile.
+func (r *registry) sync() {
+	r.mu.Lock()
+	if r.err != nil || r.w.Buffered() == 0 {
+		r.mu.Unlock()
+		return
+	}
+	r.err = r.w.Flush()
+	r.mu.Unlock()
+
+	if err := r.file.Sync(); err != nil {
+		r.mu.Lock()
+		if r.err == nil {
+			r.err = err
+		}
+		r.mu.Unlock()
+	}
+}
+
+// add indexes a new record. It returns false if the unicorn was already recorded.
+// Must be called with the lock held.
+func (r *registry) add(record *unicorn.Record) bool {
+	if _, ok := r.records[record.ID]; ok {
+		return false
+	}
+
+	r.records[record.ID] = record
+	r.ids = append(r.ids, record.ID)
+	r.byName[record.Name] = append(r.byName[record.Name], record.ID)
+	for _, c := range record.Capabilities {
+		r.byCapability[c] = append(r.byCapability[c], record.ID)
+	}
+
+	return true
+}
+
+// append buffers an event to the log, if persisted, until the log is synced.
+// Must be called with the lock held.
+func (r *registry) append(e event) {
+	if r.file == nil || r.err != nil {
+		return
+	}
+
+	b, err := json.Marshal(&e)
+	if err != nil {
+		r.err = err
+		return
+	}
+
+	if _, err := r.w.Write(append(b, '\n')); err != nil {
+		r.err = err
+	}
+}
+
+// replay reads the log at path to restore the records.
+func (r *registry) replay(path string) error {
+	return jsonlog.Replay(path, func(e event) error {
+		switch e.Op {
+		case opProduced:
+			if e.Record == nil {
+				return errors.New("produced event without record")
+			}
+			r.add(e.Record)
+		case opAssigned:
+			if record, ok := r.records[e.ID]; ok {
+				record.OrderID = e.OrderID
+			}
+		case opDelivered:
+			if record, ok := r.records[e.ID]; ok {
+				record.DeliveredAt = e.At
+			}
+		default:
+			return fmt.Errorf("unknown operation %q", e.Op)
+		}
+		return nil
+	})
+}
+
+// compact atomically rewrites the log at path so that it holds a single entry per unicorn.
+func (r *registry) compact(path string) error {
+	events := make([]event, len(r.ids))
+	for i, id := range r.ids {
+		events[i] = event{Op: opProduced, Record: r.records[id]}
+	}
+
+	return jsonlog.Rewrite(path, events)
+}
+
+// hasCapability reports whether the recorded unicorn has a capability.
+func hasCapability(record *unicorn.Record, capability string) bool {
+	for _, c := range record.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
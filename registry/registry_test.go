@@ -0,0 +1,93 @@
+package registry
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+	"unicorn"
+)
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.log")
+	at := time.Date(2022, 10, 22, 18, 4, 15, 0, time.UTC)
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := &unicorn.Unicorn{ID: "1", Name: "edible-celinda", Capabilities: []string{"fly", "swim"}, Rarity: 3, CreatedAt: at}
+	second := &unicorn.Unicorn{ID: "2", Name: "edible-celinda", Capabilities: []string{"swim"}, CreatedAt: at}
+
+	r.Produced(first)
+	r.Produced(second)
+	r.Assigned(first, "order")
+	r.Delivered(first, at)
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// replayed once to check the log, and again to check the compacted log.
+	for run := 0; run < 2; run++ {
+		r, err := Open(path)
+		if err != nil {
+			t.Fatalf("reopening registry: %v", err)
+		}
+
+		record, err := r.Unicorn("1")
+		if err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		if record.OrderID != "order" || record.DeliveredAt == nil || !record.DeliveredAt.Equal(at) || record.Rarity != 3 {
+			t.Errorf("run %d: restored %+v", run, record)
+		}
+
+		if got := r.Search(unicorn.RegistryQuery{Name: "edible-celinda"}); len(got) != 2 || got[0].ID != "1" || got[1].ID != "2" {
+			t.Errorf("run %d: found %+v by name, want unicorns 1 and 2", run, got)
+		}
+
+		if got := r.Search(unicorn.RegistryQuery{Capability: "fly"}); len(got) != 1 || got[0].ID != "1" {
+			t.Errorf("run %d: found %+v by capability, want unicorn 1", run, got)
+		}
+
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBackgroundSync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.log")
+
+	r, err := Open(path, WithSyncInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	r.Produced(&unicorn.Unicorn{ID: "1", Name: "edible-celinda"})
+
+	// the event reaches the log without closing the registry.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		replayed := New()
+		if err := replayed.replay(path); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := replayed.Unicorn("1"); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the event was not synced to the log")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestUnknownUnicorn(t *testing.T) {
+	if _, err := New().Unicorn("missing"); !errors.Is(err, unicorn.ErrUnicornNotFound) {
+		t.Errorf("err = %v, want %v", err, unicorn.ErrUnicornNotFound)
+	}
+}
@@ -0,0 +1,258 @@
+package disk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"unicorn"
+	"unicorn/pkg/jsonlog"
+	"unicorn/pkg/stack"
+
+	unicornstorage "unicorn/storage"
+)
+
+const (
+	opStore   = "store"
+	opCollect = "collect"
+	opEvict   = "evict"
+	opTake    = "take"
+)
+
+// record is a single entry of the storage append-only log.
+type record struct {
+	Op      string           `json:"op"`
+	Unicorn *unicorn.Unicorn `json:"unicorn,omitempty"`
+	N       int              `json:"n,omitempty"`
+	At      []int            `json:"at,omitempty"` // positions taken, from the bottom of the stack.
+}
+
+type storage struct {
+	mu     sync.RWMutex
+	stack  *stack.Stack[*unicorn.Unicorn]
+	config unicornstorage.Config
+
+	file *os.File
+	err  error // first error writing to the log. once set, the log is no longer written.
+}
+
+// Open creates a unicorn LIFO store persisted to an append-only log at path.
+// If the log already exists, it is replayed to restore the stored unicorns and
+// compacted so that it only contains the unicorns still in storage.
+// Restored unicorns are kept even if they exceed the storage capacity.
+func Open(path string, options ...unicornstorage.Option) (*storage, error) {
+	unicorns, err := replay(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := compact(path, unicorns); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &storage{
+		stack:  stack.New[*unicorn.Unicorn](),
+		config: unicornstorage.NewConfig(options...),
+		file:   file,
+	}
+
+	for _, u := range unicorns {
+		s.stack.Push(u)
+	}
+
+	return s, nil
+}
+
+var _ unicornstorage.UnicornStorage = (*storage)(nil)
+
+// Store places a unicorn in storage.
+// When full, the oldest unicorn is the one at the bottom of the stack.
+// Once writing to the log has failed, unicorns are no longer stored, as they would not be persisted.
+func (s *storage) Store(unicorn *unicorn.Unicorn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return fmt.Errorf("writing storage log: %w", s.err)
+	}
+
+	evict, err := s.config.Admit(s.stack.Size())
+	if err != nil {
+		return err
+	}
+
+	// the storage only changes once logged, so that a failed write loses no unicorn.
+	records := []record{{Op: opStore, Unicorn: unicorn}}
+	if evict {
+		records = []record{{Op: opEvict, N: 1}, records[0]}
+	}
+
+	if s.append(records...); s.err != nil {
+		return fmt.Errorf("writing storage log: %w", s.err)
+	}
+
+	if evict {
+		s.stack.PopBottom()
+	}
+	s.stack.Push(unicorn)
+	return nil
+}
+
+// InStorage returns the number o unicorns in storage.
+func (s *storage) InStorage() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stack.Size()
+}
+
+// Collect will do a best effort of collecting a number of unicorns from storage.
+// If there are not enough unicorns in storage, it will return any it can provide.
+// Once writing to the log has failed, no unicorn is collected, as it would be restored on the next start.
+func (s *storage) Collect(n int) []*unicorn.Unicorn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := s.stack.Size()
+	if l < n {
+		n = l
+	}
+
+	if n > 0 {
+		if s.append(record{Op: opCollect, N: n}); s.err != nil {
+			return []*unicorn.Unicorn{}
+		}
+	}
+
+	unicorns := make([]*unicorn.Unicorn, n)
+	for i := 0; i < n; i++ {
+		unicorns[i] = s.stack.Pop()
+	}
+
+	return unicorns
+}
+
+// CollectMatching collects up to n unicorns for which match returns true,
+// from the top of the stack. Other unicorns stay in storage.
+// Once writing to the log has failed, no unicorn is collected, as it would be restored on the next start.
+func (s *storage) CollectMatching(n int, match func(*unicorn.Unicorn) bool) []*unicorn.Unicorn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var at []int
+	for i := s.stack.Size() - 1; i >= 0 && len(at) < n; i-- {
+		if match(s.stack.At(i)) {
+			at = append(at, i)
+		}
+	}
+
+	if len(at) > 0 {
+		if s.append(record{Op: opTake, At: at}); s.err != nil {
+			return []*unicorn.Unicorn{}
+		}
+	}
+
+	// removed from the top, so the positions below stay valid.
+	unicorns := make([]*unicorn.Unicorn, len(at))
+	for j, i := range at {
+		unicorns[j] = s.stack.RemoveAt(i)
+	}
+
+	return unicorns
+}
+
+// Err returns the first error that occurred while writing to the log, if any.
+func (s *storage) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.err
+}
+
+// Close closes the underlying log file.
+// It returns the first error that occurred while writing to the log, if any.
+func (s *storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.file.Close(); err != nil && s.err == nil {
+		s.err = err
+	}
+
+	return s.err
+}
+
+// append writes records to the log, at once. Must be called with the lock held.
+func (s *storage) append(records ...record) {
+	if s.err != nil {
+		return
+	}
+
+	var buf []byte
+	for i := range records {
+		b, err := json.Marshal(&records[i])
+		if err != nil {
+			s.err = err
+			return
+		}
+		buf = append(append(buf, b...), '\n')
+	}
+
+	if _, err := s.file.Write(buf); err != nil {
+		s.err = err
+		return
+	}
+
+	s.err = s.file.Sync()
+}
+
+// replay reads the log at path and returns the unicorns left in storage,
+// from the bottom to the top of the stack.
+func replay(path string) ([]*unicorn.Unicorn, error) {
+	var unicorns []*unicorn.Unicorn
+
+	err := jsonlog.Replay(path, func(r record) error {
+		switch r.Op {
+		case opStore:
+			unicorns = append(unicorns, r.Unicorn)
+		case opCollect:
+			if r.N > len(unicorns) {
+				return fmt.Errorf("collecting %d unicorns from %d in storage", r.N, len(unicorns))
+			}
+			unicorns = unicorns[:len(unicorns)-r.N]
+		case opEvict:
+			if r.N > len(unicorns) {
+				return fmt.Errorf("evicting %d unicorns from %d in storage", r.N, len(unicorns))
+			}
+			unicorns = unicorns[r.N:]
+		case opTake:
+			for _, i := range r.At {
+				if i < 0 || i >= len(unicorns) {
+					return fmt.Errorf("taking unicorn %d from %d in storage", i, len(unicorns))
+				}
+				unicorns = append(unicorns[:i], unicorns[i+1:]...)
+			}
+		default:
+			return fmt.Errorf("unknown operation %q", r.Op)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return unicorns, nil
+}
+
+// compact atomically rewrites the log at path so that it only stores unicorns.
+func compact(path string, unicorns []*unicorn.Unicorn) error {
+	records := make([]record, len(unicorns))
+	for i, u := range unicorns {
+		records[i] = record{Op: opStore, Unicorn: u}
+	}
+
+	return jsonlog.Rewrite(path, records)
+}
@@ -0,0 +1,145 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"unicorn"
+
+	unicornstorage "unicorn/storage"
+)
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.log")
+
+	s, err := Open(path, unicornstorage.WithCapacity(4, unicornstorage.EvictOldest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"a", "b", "c", "d", "e", "f"} {
+		if err := s.Store(&unicorn.Unicorn{ID: id, Capabilities: []string{id}}); err != nil {
+			t.Fatalf("storing unicorn %s: %v", id, err)
+		}
+	}
+	// a and b were evicted, leaving c d e f.
+
+	if got := s.Collect(1); len(got) != 1 || got[0].ID != "f" {
+		t.Fatalf("collected %v, want f", ids(got))
+	}
+
+	if got := s.CollectMatching(1, func(u *unicorn.Unicorn) bool { return u.Has("d") }); len(got) != 1 || got[0].ID != "d" {
+		t.Fatalf("collected matching %v, want d", ids(got))
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// replayed once to check the log, and again to check the compacted log.
+	for run := 0; run < 2; run++ {
+		s, err := Open(path)
+		if err != nil {
+			t.Fatalf("reopening storage: %v", err)
+		}
+
+		if got, want := ids(s.Collect(10)), []string{"e", "c"}; !equal(got, want) {
+			t.Errorf("run %d: restored %v, want %v", run, got, want)
+		}
+
+		// put them back for the next run, bottom first.
+		for _, id := range []string{"c", "e"} {
+			if err := s.Store(&unicorn.Unicorn{ID: id}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReplayTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.log")
+
+	log := `{"op":"store","unicorn":{"id":"a"}}` + "\n" + `{"op":"store","unic`
+	if err := os.WriteFile(path, []byte(log), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("opening truncated log: %v", err)
+	}
+	defer s.Close()
+
+	if got := ids(s.Collect(10)); !equal(got, []string{"a"}) {
+		t.Errorf("restored %v, want [a]", got)
+	}
+}
+
+func TestLogFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.log")
+
+	s, err := Open(path, unicornstorage.WithCapacity(2, unicornstorage.EvictOldest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"a", "b"} {
+		if err := s.Store(&unicorn.Unicorn{ID: id, Capabilities: []string{id}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.file.Close() // writing to the log fails from now on.
+
+	// storing would evict a, which must stay in storage as the store was not logged.
+	if err := s.Store(&unicorn.Unicorn{ID: "c"}); err == nil {
+		t.Fatal("stored a unicorn that could not be written to the log")
+	}
+
+	if got := s.Collect(1); len(got) != 0 {
+		t.Errorf("collected %v after the log failed", ids(got))
+	}
+
+	if got := s.CollectMatching(1, func(*unicorn.Unicorn) bool { return true }); len(got) != 0 {
+		t.Errorf("collected matching %v after the log failed", ids(got))
+	}
+
+	if n := s.InStorage(); n != 2 {
+		t.Errorf("%d unicorns in storage, want 2", n)
+	}
+
+	// the log holds the same unicorns, none was delivered from storage.
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if got, want := ids(s.Collect(10)), []string{"b", "a"}; !equal(got, want) {
+		t.Errorf("restored %v, want %v", got, want)
+	}
+}
+
+func ids(unicorns []*unicorn.Unicorn) []string {
+	ids := make([]string, len(unicorns))
+	for i, u := range unicorns {
+		ids[i] = u.ID
+	}
+	return ids
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
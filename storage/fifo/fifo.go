@@ -0,0 +1,78 @@
+package fifo
+
+import (
+	"sync"
+	"unicorn"
+	"unicorn/pkg/queue"
+
+	unicornstorage "unicorn/storage"
+)
+
+type storage struct {
+	mu     sync.RWMutex
+	queue  *queue.Queue[*unicorn.Unicorn]
+	config unicornstorage.Config
+}
+
+// New creates a unicorn FIFO store, where the oldest unicorns leave storage first.
+func New(options ...unicornstorage.Option) *storage {
+	return &storage{
+		queue:  queue.New[*unicorn.Unicorn](),
+		config: unicornstorage.NewConfig(options...),
+	}
+}
+
+var _ unicornstorage.UnicornStorage = (*storage)(nil)
+
+// Store places a unicorn in storage.
+// When full, the oldest unicorn is the one at the front of the queue.
+func (s *storage) Store(unicorn *unicorn.Unicorn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evict, err := s.config.Admit(s.queue.Len())
+	if err != nil {
+		return err
+	}
+
+	if evict {
+		s.queue.TryDequeue()
+	}
+
+	s.queue.Enqueue(unicorn)
+	return nil
+}
+
+// InStorage returns the number o unicorns in storage.
+func (s *storage) InStorage() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.queue.Len()
+}
+
+// Collect will do a best effort of collecting a number of unicorns from storage.
+// If there are not enough unicorns in storage, it will return any it can provide.
+func (s *storage) Collect(n int) []*unicorn.Unicorn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l := s.queue.Len(); l < n {
+		n = l
+	}
+
+	unicorns := make([]*unicorn.Unicorn, n)
+	for i := 0; i < n; i++ {
+		unicorns[i] = s.queue.Dequeue()
+	}
+
+	return unicorns
+}
+
+// CollectMatching collects up to n unicorns for which match returns true,
+// oldest first. Other unicorns stay in storage.
+func (s *storage) CollectMatching(n int, match func(*unicorn.Unicorn) bool) []*unicorn.Unicorn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*unicorn.Unicorn{}, s.queue.ExtractFunc(n, match)...)
+}
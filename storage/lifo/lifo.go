@@ -9,24 +9,38 @@ import (
 )
 
 type storage struct {
-	mu    sync.RWMutex
-	stack *stack.Stack[*unicorn.Unicorn]
+	mu     sync.RWMutex
+	stack  *stack.Stack[*unicorn.Unicorn]
+	config unicornstorage.Config
 }
 
 // New creates a unicorn LIFO store.
-func New() *storage {
+func New(options ...unicornstorage.Option) *storage {
 	return &storage{
-		stack: stack.New[*unicorn.Unicorn](),
+		stack:  stack.New[*unicorn.Unicorn](),
+		config: unicornstorage.NewConfig(options...),
 	}
 }
 
 var _ unicornstorage.UnicornStorage = (*storage)(nil)
 
 // Store places a unicorn in storage.
-func (s *storage) Store(unicorn *unicorn.Unicorn) {
+// When full, the oldest unicorn is the one at the bottom of the stack.
+func (s *storage) Store(unicorn *unicorn.Unicorn) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+
+	evict, err := s.config.Admit(s.stack.Size())
+	if err != nil {
+		return err
+	}
+
+	if evict {
+		s.stack.PopBottom()
+	}
+
 	s.stack.Push(unicorn)
+	return nil
 }
 
 // InStorage returns the number o unicorns in storage.
@@ -61,3 +75,19 @@ func (s *storage) Collect(n int) []*unicorn.Unicorn {
 
 	return unicorns
 }
+
+// CollectMatching collects up to n unicorns for which match returns true,
+// from the top of the stack. Other unicorns stay in storage.
+func (s *storage) CollectMatching(n int, match func(*unicorn.Unicorn) bool) []*unicorn.Unicorn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unicorns := []*unicorn.Unicorn{}
+	for i := s.stack.Size() - 1; i >= 0 && len(unicorns) < n; i-- {
+		if match(s.stack.At(i)) {
+			unicorns = append(unicorns, s.stack.RemoveAt(i))
+		}
+	}
+
+	return unicorns
+}
@@ -19,9 +19,14 @@ func WithLogs(logger *log.Logger, store UnicornStorage) UnicornStorage {
 }
 
 // Store places a unicorn in storage.
-func (l *storageLogger) Store(unicorn *unicorn.Unicorn) {
-	l.store.Store(unicorn)
+func (l *storageLogger) Store(unicorn *unicorn.Unicorn) error {
+	if err := l.store.Store(unicorn); err != nil {
+		l.logger.Printf("storage: could not store unicorn<%s>: %v", unicorn.Name, err)
+		return err
+	}
+
 	l.logger.Printf("storage: stored unicorn<%s>, now with %d", unicorn.Name, l.store.InStorage())
+	return nil
 }
 
 // InStorage returns the number o unicorns in storage.
@@ -36,3 +41,10 @@ func (l *storageLogger) Collect(n int) []*unicorn.Unicorn {
 	l.logger.Printf("storage: collected %d from the requested %d", len(unicorns), n)
 	return unicorns
 }
+
+// CollectMatching collects up to n unicorns for which match returns true.
+func (l *storageLogger) CollectMatching(n int, match func(*unicorn.Unicorn) bool) []*unicorn.Unicorn {
+	unicorns := l.store.CollectMatching(n, match)
+	l.logger.Printf("storage: collected %d matching from the requested %d", len(unicorns), n)
+	return unicorns
+}
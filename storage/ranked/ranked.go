@@ -0,0 +1,110 @@
+package ranked
+
+import (
+	"sync"
+	"unicorn"
+	"unicorn/pkg/pqueue"
+
+	unicornstorage "unicorn/storage"
+)
+
+// item is a stored unicorn, with the order in which it was stored.
+type item struct {
+	unicorn *unicorn.Unicorn
+	seq     uint64
+}
+
+type storage struct {
+	mu     sync.RWMutex
+	queue  *pqueue.PriorityQueue[item]
+	seq    uint64 // of the next stored unicorn
+	config unicornstorage.Config
+}
+
+// New creates a unicorn store where the unicorns with the most capabilities leave storage first.
+// Unicorns with the same number of capabilities leave First In First Out.
+func New(options ...unicornstorage.Option) *storage {
+	return &storage{
+		queue:  pqueue.New(moreCapable),
+		config: unicornstorage.NewConfig(options...),
+	}
+}
+
+// moreCapable reports whether a has more capabilities than b.
+func moreCapable(a, b item) bool {
+	return len(a.unicorn.Capabilities) > len(b.unicorn.Capabilities)
+}
+
+var _ unicornstorage.UnicornStorage = (*storage)(nil)
+
+// Store places a unicorn in storage.
+func (s *storage) Store(unicorn *unicorn.Unicorn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evict, err := s.config.Admit(s.queue.Len())
+	if err != nil {
+		return err
+	}
+
+	if evict {
+		s.evictOldest()
+	}
+
+	s.queue.Push(item{unicorn: unicorn, seq: s.seq})
+	s.seq++
+	return nil
+}
+
+// evictOldest removes the unicorn stored the longest ago. Must be called with the lock held.
+func (s *storage) evictOldest() {
+	oldest := s.seq
+	s.queue.Each(func(it item) {
+		if it.seq < oldest {
+			oldest = it.seq
+		}
+	})
+
+	s.queue.RemoveFunc(func(it item) bool { return it.seq == oldest })
+}
+
+// InStorage returns the number o unicorns in storage.
+func (s *storage) InStorage() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.queue.Len()
+}
+
+// Collect will do a best effort of collecting a number of unicorns from storage.
+// If there are not enough unicorns in storage, it will return any it can provide.
+func (s *storage) Collect(n int) []*unicorn.Unicorn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l := s.queue.Len(); l < n {
+		n = l
+	}
+
+	unicorns := make([]*unicorn.Unicorn, n)
+	for i := 0; i < n; i++ {
+		unicorns[i] = s.queue.Pop().unicorn
+	}
+
+	return unicorns
+}
+
+// CollectMatching collects up to n unicorns for which match returns true,
+// with the most capabilities first. Other unicorns stay in storage.
+func (s *storage) CollectMatching(n int, match func(*unicorn.Unicorn) bool) []*unicorn.Unicorn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.queue.ExtractFunc(n, func(it item) bool { return match(it.unicorn) })
+
+	unicorns := make([]*unicorn.Unicorn, len(items))
+	for i, it := range items {
+		unicorns[i] = it.unicorn
+	}
+
+	return unicorns
+}
@@ -1,10 +1,25 @@
 package storage
 
-import "unicorn"
+import (
+	"errors"
+	"fmt"
+	"unicorn"
+)
+
+var (
+	// ErrFull is returned when storing in a full storage with the Backpressure policy.
+	// The caller should hold the unicorn and retry later.
+	ErrFull = errors.New("storage is full")
+
+	// ErrDropped is returned when storing in a full storage with the DropNewest policy.
+	// The unicorn has been discarded.
+	ErrDropped = errors.New("storage is full, unicorn dropped")
+)
 
 type UnicornStorage interface {
 	// Store places a unicorn in storage.
-	Store(unicorn *unicorn.Unicorn)
+	// It returns an error if the unicorn could not be stored.
+	Store(unicorn *unicorn.Unicorn) error
 
 	// InStorage returns the number o unicorns in storage.
 	InStorage() int
@@ -12,4 +27,90 @@ type UnicornStorage interface {
 	// Collect will do a best effort of collecting a number of unicorns from storage.
 	// If there are not enough unicorns in storage, it will return any it can provide.
 	Collect(n int) []*unicorn.Unicorn
+
+	// CollectMatching collects up to n unicorns for which match returns true,
+	// in the same order as Collect. Other unicorns stay in storage.
+	CollectMatching(n int, match func(*unicorn.Unicorn) bool) []*unicorn.Unicorn
+}
+
+// OverflowPolicy decides what happens when storing a unicorn in a full storage.
+type OverflowPolicy int
+
+// Overflow policies.
+const (
+	DropNewest   OverflowPolicy = iota // discards the unicorn being stored.
+	EvictOldest                        // discards the oldest unicorn in storage, to make room.
+	Backpressure                       // rejects the unicorn, so the producer holds it until there is room.
+)
+
+var overflowPolicyNames = map[OverflowPolicy]string{
+	DropNewest:   "drop-newest",
+	EvictOldest:  "evict-oldest",
+	Backpressure: "backpressure",
+}
+
+// ParseOverflowPolicy parses a policy name: drop-newest, evict-oldest or backpressure.
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	for p, name := range overflowPolicyNames {
+		if name == s {
+			return p, nil
+		}
+	}
+	return DropNewest, fmt.Errorf("unknown overflow policy %q", s)
+}
+
+func (p OverflowPolicy) String() string {
+	if name, ok := overflowPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("policy(%d)", int(p))
+}
+
+// Config is the configuration shared by the unicorn storages.
+type Config struct {
+	// Capacity is the maximum number of unicorns in storage. unlimited if zero.
+	Capacity int
+
+	// Overflow decides what happens when storing a unicorn in a full storage.
+	Overflow OverflowPolicy
+}
+
+// Option is function used to customize a storage.
+type Option func(*Config)
+
+// WithCapacity limits the number of unicorns in storage, applying the policy when it is full.
+func WithCapacity(capacity int, policy OverflowPolicy) Option {
+	return func(c *Config) {
+		c.Capacity = capacity
+		c.Overflow = policy
+	}
+}
+
+// NewConfig creates a storage configuration from the options.
+func NewConfig(options ...Option) Config {
+	var c Config
+	for _, opt := range options {
+		if opt != nil {
+			opt(&c)
+		}
+	}
+	return c
+}
+
+// Admit decides if a unicorn can be stored in a storage holding size unicorns.
+// It returns true if the oldest unicorn must be evicted to make room,
+// or an error if the unicorn must not be stored.
+func (c Config) Admit(size int) (evict bool, err error) {
+	if c.Capacity <= 0 || size < c.Capacity {
+		return false, nil
+	}
+
+	switch c.Overflow {
+	case EvictOldest:
+		return true, nil
+	case Backpressure:
+		return false, ErrFull
+	default:
+		return false, ErrDropped
+	}
 }
@@ -0,0 +1,72 @@
+package storage_test
+
+import (
+	"path/filepath"
+	"testing"
+	"unicorn"
+	"unicorn/storage"
+	"unicorn/storage/disk"
+	"unicorn/storage/fifo"
+	"unicorn/storage/lifo"
+	"unicorn/storage/ranked"
+)
+
+func TestCollectMatching(t *testing.T) {
+	tests := []struct {
+		name string
+		open func(t *testing.T) storage.UnicornStorage
+		want []string // IDs of the flying unicorns, in the order they leave storage
+	}{
+		{"lifo", func(*testing.T) storage.UnicornStorage { return lifo.New() }, []string{"d", "b"}},
+		{"fifo", func(*testing.T) storage.UnicornStorage { return fifo.New() }, []string{"a", "b"}},
+		{"ranked", func(*testing.T) storage.UnicornStorage { return ranked.New() }, []string{"b", "a"}},
+		{"disk", func(t *testing.T) storage.UnicornStorage {
+			s, err := disk.Open(filepath.Join(t.TempDir(), "storage.log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		}, []string{"d", "b"}},
+	}
+
+	stock := []*unicorn.Unicorn{
+		{ID: "a", Capabilities: []string{"fly"}},
+		{ID: "b", Capabilities: []string{"fly", "swim"}},
+		{ID: "c", Capabilities: []string{"swim"}},
+		{ID: "d", Capabilities: []string{"fly"}},
+	}
+	flying := func(u *unicorn.Unicorn) bool { return u.Has("fly") }
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.open(t)
+			for _, u := range stock {
+				if err := s.Store(u); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := s.CollectMatching(2, flying)
+			if len(got) != len(tt.want) {
+				t.Fatalf("collected %d unicorns, want %d", len(got), len(tt.want))
+			}
+			for i, u := range got {
+				if u.ID != tt.want[i] {
+					t.Errorf("collected %s at %d, want %s", u.ID, i, tt.want[i])
+				}
+			}
+
+			// the others stay in storage, with one flying unicorn left.
+			if n := s.InStorage(); n != 2 {
+				t.Errorf("%d unicorns in storage, want 2", n)
+			}
+			if left := s.CollectMatching(10, flying); len(left) != 1 {
+				t.Errorf("%d flying unicorns left, want 1", len(left))
+			}
+			if none := s.CollectMatching(10, flying); len(none) != 0 {
+				t.Errorf("collected %d flying unicorns from storage without any", len(none))
+			}
+		})
+	}
+}
@@ -1,24 +1,298 @@
 package unicorn
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrOrderNotFound   = errors.New("order not found")
+	ErrOrderExpired    = errors.New("order expired")
+	ErrInvalidPriority = errors.New("invalid order priority")
+	ErrLineNotFound    = errors.New("production line not found")
+	ErrInvalidRate     = errors.New("invalid production rate")
+	ErrInvalidFilter   = errors.New("invalid capability filter")
+	ErrInvalidSpec     = errors.New("invalid unicorn spec")
+	ErrUnicornNotFound = errors.New("unicorn not found")
+	ErrInvalidCallback = errors.New("invalid callback URL")
+)
+
 // Unicorn is a horse with a beautiful horn.
 // They are have funny names and can do a lot of stuff.
 type Unicorn struct {
-	Name         string   `json:"name"`
-	Capabilities []string `json:"capabilities"`
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Capabilities []string  `json:"capabilities"`
+	Rarity       int       `json:"rarity"` // score of its capabilities. the higher, the rarer.
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Has reports whether the unicorn has a capability.
+func (u *Unicorn) Has(capability string) bool {
+	for _, c := range u.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// CapabilityFilter selects unicorns by their capabilities.
+// The zero value matches every unicorn.
+type CapabilityFilter struct {
+	Required []string `json:"required,omitempty"` // capabilities the unicorn must have.
+	Excluded []string `json:"excluded,omitempty"` // capabilities the unicorn must not have.
+}
+
+// Empty reports whether the filter matches every unicorn.
+func (f CapabilityFilter) Empty() bool {
+	return len(f.Required) == 0 && len(f.Excluded) == 0
+}
+
+// Match reports whether the unicorn has all the required capabilities and none of the excluded.
+func (f CapabilityFilter) Match(u *Unicorn) bool {
+	for _, c := range f.Required {
+		if !u.Has(c) {
+			return false
+		}
+	}
+	for _, c := range f.Excluded {
+		if u.Has(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks that no capability is both required and excluded.
+func (f CapabilityFilter) Validate() error {
+	for _, r := range f.Required {
+		for _, e := range f.Excluded {
+			if r == e {
+				return fmt.Errorf("%w: %q is both required and excluded", ErrInvalidFilter, r)
+			}
+		}
+	}
+	return nil
+}
+
+// Spec describes a custom-built unicorn.
+type Spec struct {
+	Capabilities []string `json:"capabilities"`         // the unicorn is built with exactly these.
+	NamePrefix   string   `json:"namePrefix,omitempty"` // replaces the random adjective of the name.
 }
 
 // OrderID is used to identify pending unicorn production request orders.
 type OrderID string
 
+// Priority is the class of service of an order.
+// Orders with higher priority are fulfilled first.
+type Priority int
+
+// Order priorities.
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+)
+
+var priorityNames = map[Priority]string{
+	PriorityLow:    "low",
+	PriorityNormal: "normal",
+	PriorityHigh:   "high",
+}
+
+// ParsePriority parses a priority name: low, normal or high.
+func ParsePriority(s string) (Priority, error) {
+	for p, name := range priorityNames {
+		if name == s {
+			return p, nil
+		}
+	}
+	return PriorityNormal, fmt.Errorf("%w: %q", ErrInvalidPriority, s)
+}
+
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("priority(%d)", int(p))
+}
+
+func (p Priority) MarshalText() ([]byte, error) {
+	if _, ok := priorityNames[p]; !ok {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidPriority, int(p))
+	}
+	return []byte(p.String()), nil
+}
+
+func (p *Priority) UnmarshalText(text []byte) error {
+	priority, err := ParsePriority(string(text))
+	if err != nil {
+		return err
+	}
+	*p = priority
+	return nil
+}
+
+// OrderStatus describes the progress of a unicorn production order.
+type OrderStatus struct {
+	ID        OrderID  `json:"orderId"`
+	Priority  Priority `json:"priority"`
+	Amount    int      `json:"amount"`    // of unicorns ordered.
+	Produced  int      `json:"produced"`  // unicorns produced for the order.
+	Ready     int      `json:"ready"`     // unicorns waiting to be collected.
+	Delivered int      `json:"delivered"` // unicorns already collected.
+	Pending   int      `json:"pending"`   // unicorns left to produce.
+
+	Capabilities CapabilityFilter `json:"capabilities"`   // the ordered unicorns must match.
+	Spec         *Spec            `json:"spec,omitempty"` // of custom-built unicorns.
+}
+
+// OrderOptions are the optional parameters of a unicorn production order.
+type OrderOptions struct {
+	// CallbackURL is notified with the order unicorns once its production has completed.
+	CallbackURL string
+
+	// TTL is how long the order is kept without being polled, before expiring.
+	// If zero, the service default is used.
+	TTL time.Duration
+
+	// Priority of the order in the production queue.
+	Priority Priority
+
+	// Capabilities the ordered unicorns must match.
+	Capabilities CapabilityFilter
+
+	// Spec of the unicorns to custom-build for the order, instead of taking them
+	// from stock or the regular production. Not custom-built if nil.
+	Spec *Spec
+}
+
+// OrderOption is function used to customize an order.
+type OrderOption func(*OrderOptions)
+
+// WithCallback sets the URL to notify once the order production has completed.
+func WithCallback(url string) OrderOption {
+	return func(o *OrderOptions) {
+		o.CallbackURL = url
+	}
+}
+
+// WithTTL sets how long the order is kept without being polled, before expiring.
+func WithTTL(ttl time.Duration) OrderOption {
+	return func(o *OrderOptions) {
+		o.TTL = ttl
+	}
+}
+
+// WithPriority sets the order priority in the production queue.
+func WithPriority(p Priority) OrderOption {
+	return func(o *OrderOptions) {
+		o.Priority = p
+	}
+}
+
+// WithCapabilities only fulfills the order with unicorns having all the required
+// capabilities and none of the excluded.
+func WithCapabilities(required, excluded []string) OrderOption {
+	return func(o *OrderOptions) {
+		o.Capabilities = CapabilityFilter{Required: required, Excluded: excluded}
+	}
+}
+
+// WithSpec custom-builds the ordered unicorns to the spec.
+func WithSpec(spec Spec) OrderOption {
+	return func(o *OrderOptions) {
+		o.Spec = &spec
+	}
+}
+
+// LineStats describes a unicorn production line.
+type LineStats struct {
+	ID       int
+	Paused   bool          // paused lines do not produce unicorns.
+	Rate     time.Duration // period in which the line produces a unicorn.
+	Produced int           // unicorns produced by the line.
+	Dropped  int           // unicorns discarded for not fitting in storage.
+	Blocked  bool          // blocked lines wait for room in storage to produce.
+}
+
+// Production controls the unicorn production lines.
+type Production interface {
+	// Lines returns the statistics of every production line.
+	Lines() []LineStats
+
+	// Line returns the statistics of a production line.
+	Line(id int) (LineStats, error)
+
+	// Pause stops a production line from producing unicorns, until resumed.
+	Pause(id int) error
+
+	// Resume restarts the production of a paused line.
+	Resume(id int) error
+
+	// SetRate changes the period in which a production line produces a unicorn.
+	SetRate(id int, rate time.Duration) error
+
+	// NewLine adds a production line, producing a unicorn at every rate.
+	// It returns the ID of the new line.
+	NewLine(rate time.Duration) (int, error)
+
+	// RemoveLine stops a production line and removes it.
+	RemoveLine(id int) error
+}
+
 // Service is a service that can produce happy beautiful unicorns.
 type Service interface {
 	// RequestUnicorns initiates a new unicorn production request.
 	// If no sufficient unicorn are available, it returns a request ID for consequent pooling.
-	OrderUnicorns(amount int) (OrderID, error)
+	OrderUnicorns(amount int, options ...OrderOption) (OrderID, error)
 
 	// Pool returns the available ordered unicorns and how many are left to produce.
 	Pool(OrderID) ([]*Unicorn, int, error)
 
+	// CancelOrder cancels a pending order.
+	// Its produced unicorns that were not collected go to the other pending orders
+	// accepting them, as new production, or else back to stock.
+	CancelOrder(OrderID) error
+
+	// Status returns the progress of an order, without collecting its unicorns.
+	Status(OrderID) (OrderStatus, error)
+
+	// Wait blocks until the order has unicorns ready to be collected,
+	// its production has completed or the context is done.
+	Wait(context.Context, OrderID) error
+
 	// Validate checks if an ID has an orden in the process.
 	Validate(OrderID) bool
 }
+
+// Record is the history of a produced unicorn.
+type Record struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Capabilities []string   `json:"capabilities"`
+	Rarity       int        `json:"rarity"`
+	ProducedAt   time.Time  `json:"producedAt"`
+	OrderID      OrderID    `json:"orderId,omitempty"`     // order the unicorn went to, if any.
+	DeliveredAt  *time.Time `json:"deliveredAt,omitempty"` // when it was delivered to the client, if it was.
+}
+
+// RegistryQuery selects unicorn records. Empty fields match every record.
+type RegistryQuery struct {
+	Name       string // exact unicorn name.
+	Capability string // the unicorn must have.
+	Limit      int    // maximum number of records. unlimited if zero.
+}
+
+// Registry keeps the records of every produced unicorn.
+type Registry interface {
+	// Unicorn returns the record of a unicorn by its ID.
+	Unicorn(id string) (Record, error)
+
+	// Search returns the records matching the query, in the order the unicorns were produced.
+	Search(query RegistryQuery) []Record
+}